@@ -22,6 +22,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"log/slog"
 
@@ -30,6 +31,7 @@ import (
 	"github.com/thalassa-cloud/csi-thalassa/driver"
 	"github.com/thalassa-cloud/csi-thalassa/driver/defaults"
 	"github.com/thalassa-cloud/csi-thalassa/driver/version"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 var pluginCmd = &cobra.Command{
@@ -63,14 +65,19 @@ var pluginCmd = &cobra.Command{
 				Region:               viper.GetString("thalassa-region"),
 				ThalassaProject:      viper.GetString("thalassa-project"),
 
-				DriverName:           viper.GetString("driver-name"),
-				DebugAddr:            viper.GetString("debug-addr"),
-				VolumeLimit:          viper.GetUint("volume-limit"),
-				ThalassaOrganisation: viper.GetString("organisation"),
-				KubeConfig:           viper.GetString("kube-config"),
-				NodeID:               viper.GetString("node-id"),
-				Cluster:              viper.GetString("cluster"),
-				Vpc:                  viper.GetString("vpc"),
+				DriverName:               viper.GetString("driver-name"),
+				DebugAddr:                viper.GetString("debug-addr"),
+				VolumeLimit:              viper.GetUint("volume-limit"),
+				ThalassaOrganisation:     viper.GetString("organisation"),
+				KubeConfig:               viper.GetString("kube-config"),
+				NodeID:                   viper.GetString("node-id"),
+				Cluster:                  viper.GetString("cluster"),
+				Vpc:                      viper.GetString("vpc"),
+				CustomLabels:             viper.GetString("custom-labels"),
+				CustomAnnotations:        viper.GetString("custom-annotations"),
+				WaitForSnapshotReady:     viper.GetBool("wait-for-snapshot-ready"),
+				MultiAttachVolumeTypes:   viper.GetString("multi-attach-volume-types"),
+				OfflineResizeVolumeTypes: viper.GetString("offline-resize-volume-types"),
 			})
 			if err != nil {
 				return fmt.Errorf("failed to create controller: %w", err)
@@ -80,17 +87,38 @@ var pluginCmd = &cobra.Command{
 				return fmt.Errorf("failed to run driver: %w", err)
 			}
 		case "node":
+			ephemeralMaxSize, err := resource.ParseQuantity(viper.GetString("ephemeral-max-size"))
+			if err != nil {
+				return fmt.Errorf("invalid ephemeral-max-size: %w", err)
+			}
 			drv, err := driver.NewNodeDriver(driver.NewNodeDriverParams{
-				CsiEndpoint:        viper.GetString("csi-endpoint"),
-				DriverName:         viper.GetString("driver-name"),
-				DebugAddr:          viper.GetString("debug-addr"),
-				ValidateAttachment: viper.GetBool("validate-attachment"),
-				VolumeLimit:        viper.GetUint("volume-limit"),
-				NodeID:             viper.GetString("node-id"),
-				Region:             viper.GetString("thalassa-region"),
-				Project:            viper.GetString("thalassa-project"),
-				Cluster:            viper.GetString("cluster"),
-				Vpc:                viper.GetString("vpc"),
+				CsiEndpoint:          viper.GetString("csi-endpoint"),
+				DriverName:           viper.GetString("driver-name"),
+				DebugAddr:            viper.GetString("debug-addr"),
+				ValidateAttachment:   viper.GetBool("validate-attachment"),
+				VolumeLimit:          viper.GetUint("volume-limit"),
+				NodeID:               viper.GetString("node-id"),
+				Region:               viper.GetString("thalassa-region"),
+				Project:              viper.GetString("thalassa-project"),
+				Cluster:              viper.GetString("cluster"),
+				Vpc:                  viper.GetString("vpc"),
+				KubeConfig:           viper.GetString("kube-config"),
+				CustomLabels:         viper.GetString("custom-labels"),
+				MountPropagationMode: viper.GetString("mount-propagation-mode"),
+				KubeletDir:           viper.GetString("kubelet-dir"),
+				DeviceWaitTimeout:    viper.GetDuration("device-wait-timeout"),
+				DeviceWaitInterval:   viper.GetDuration("device-wait-interval"),
+				CustomAnnotations:    viper.GetString("custom-annotations"),
+
+				ThalassaToken:          viper.GetString("thalassa-token"),
+				ThalassaClientID:       viper.GetString("thalassa-client-id"),
+				ThalassaClientSecret:   viper.GetString("thalassa-client-secret"),
+				ThalassaURL:            viper.GetString("thalassa-url"),
+				ThalassaInsecure:       viper.GetBool("thalassa-insecure"),
+				ThalassaOrganisation:   viper.GetString("organisation"),
+				EphemeralVolumeTypes:   viper.GetString("ephemeral-volume-types"),
+				EphemeralMaxSize:       ephemeralMaxSize.Value(),
+				EphemeralSweepInterval: viper.GetDuration("ephemeral-sweep-interval"),
 			})
 			if err != nil {
 				return fmt.Errorf("failed to create node driver: %w", err)
@@ -116,11 +144,21 @@ func init() {
 	pluginCmd.Flags().String("driver-name", defaults.DefaultDriverName, "Name for the driver")
 	pluginCmd.Flags().String("debug-addr", "", "Address to serve the HTTP debug server on")
 	pluginCmd.Flags().Bool("validate-attachment", false, "Validate if the attachment has fully completed before formatting/mounting the device")
+	pluginCmd.Flags().String("mount-propagation-mode", "strict", "How the node treats mounts without shared propagation: strict fails, warn logs a warning, ignore skips the check")
+	pluginCmd.Flags().String("kubelet-dir", "/var/lib/kubelet", "Kubelet root directory, used to check its mount propagation at startup")
+	pluginCmd.Flags().Duration("device-wait-timeout", 30*time.Second, "How long NodeStageVolume waits for the device of an attached volume to appear")
+	pluginCmd.Flags().Duration("device-wait-interval", time.Second, "How often NodeStageVolume looks for the device of an attached volume when inotify is not available")
 
 	pluginCmd.Flags().Uint("volume-limit", 20, "Volumes per node limit")
 	pluginCmd.Flags().String("node-id", "", "Node ID")
 	pluginCmd.Flags().String("custom-labels", "", "Additional custom labels to add to the driver")
 	pluginCmd.Flags().String("custom-annotations", "", "Additional custom annotations to add to the driver")
+	pluginCmd.Flags().String("multi-attach-volume-types", "", "Comma separated volume type names or identities that can be attached to multiple machines, required for ReadOnlyMany volumes")
+	pluginCmd.Flags().String("offline-resize-volume-types", "", "Comma separated volume type names or identities that can only be resized while the volume is not attached")
+	pluginCmd.Flags().String("ephemeral-volume-types", "", "Comma separated volume type names or identities the node may create inline ephemeral volumes with, the first is the default. Ephemeral volumes are disabled when empty")
+	pluginCmd.Flags().String("ephemeral-max-size", "100Gi", "Maximum size of an inline ephemeral volume")
+	pluginCmd.Flags().Duration("ephemeral-sweep-interval", 10*time.Minute, "How often the node deletes inline ephemeral volumes that are no longer mounted")
+	pluginCmd.Flags().Bool("wait-for-snapshot-ready", false, "Block CreateSnapshot until the snapshot is available instead of returning it while it is still being created")
 
 	pluginCmd.Flags().String("thalassa-token", "", "Thalassa Cloud access token")
 	pluginCmd.Flags().String("thalassa-client-id", "", "Thalassa Cloud client ID")
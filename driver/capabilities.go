@@ -19,8 +19,11 @@ package driver
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/thalassa-cloud/client-go/iaas"
 	"github.com/thalassa-cloud/client-go/pkg/client"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -33,15 +36,15 @@ func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Valida
 		return nil, status.Error(codes.InvalidArgument, "ValidateVolumeCapabilities Volume ID must be provided")
 	}
 
-	if req.VolumeCapabilities == nil {
+	if len(req.VolumeCapabilities) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "ValidateVolumeCapabilities Volume Capabilities must be provided")
 	}
 
-	log := d.log.With("volume_id", req.VolumeId, "volume_capabilities", req.VolumeCapabilities, "supported_capabilities", supportedAccessMode, "method", "validate_volume_capabilities")
+	log := d.log.With("volume_id", req.VolumeId, "volume_capabilities", req.VolumeCapabilities, "supported_access_modes", supportedAccessModes, "method", "validate_volume_capabilities")
 	log.Info("validating volume capabilities")
 
 	// check if volume exist before trying to validate it it
-	_, err := d.iaas.GetVolume(ctx, req.VolumeId)
+	vol, err := d.iaas.GetVolume(ctx, req.VolumeId)
 	if err != nil {
 		if client.IsNotFound(err) {
 			return nil, status.Errorf(codes.NotFound, "volume %q does not exist", req.VolumeId)
@@ -49,14 +52,19 @@ func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Valida
 		return nil, err
 	}
 
-	// if it's not supported (i.e: wrong region), we shouldn't override it
+	if message := d.unsupportedCapabilities(vol, req); message != "" {
+		log.With("reason", message).Info("volume capabilities are not supported")
+		return &csi.ValidateVolumeCapabilitiesResponse{
+			Message: message,
+		}, nil
+	}
+
 	resp := &csi.ValidateVolumeCapabilitiesResponse{
 		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
-			VolumeCapabilities: []*csi.VolumeCapability{
-				{
-					AccessMode: supportedAccessMode,
-				},
-			},
+			VolumeContext:      req.VolumeContext,
+			VolumeCapabilities: req.VolumeCapabilities,
+			Parameters:         req.Parameters,
+			MutableParameters:  req.MutableParameters,
 		},
 	}
 
@@ -64,6 +72,34 @@ func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Valida
 	return resp, nil
 }
 
+// unsupportedCapabilities returns why the capabilities and parameters of the
+// request are not supported for the volume, or an empty string when they
+// are.
+func (d *Driver) unsupportedCapabilities(vol *iaas.Volume, req *csi.ValidateVolumeCapabilitiesRequest) string {
+	if violations := validateCapabilities(req.VolumeCapabilities); len(violations) > 0 {
+		return fmt.Sprintf("volume capabilities cannot be satisified: %s", strings.Join(violations, "; "))
+	}
+
+	if isMultiNodeCapability(req.VolumeCapabilities...) {
+		if vol.VolumeType == nil || !d.allowsMultiAttach(vol.VolumeType.Identity, vol.VolumeType.Name) {
+			return "volume capabilities cannot be satisified: the volume type cannot be attached to multiple machines"
+		}
+	}
+
+	if err := validateFsTypes(req.VolumeCapabilities, req.Parameters); err != nil {
+		return err.Error()
+	}
+
+	// the filesystem parameters are validated as they are for CreateVolume
+	if _, err := createVolumeContext(&csi.CreateVolumeRequest{
+		Parameters:         req.Parameters,
+		VolumeCapabilities: req.VolumeCapabilities,
+	}); err != nil {
+		return status.Convert(err).Message()
+	}
+	return ""
+}
+
 // ControllerGetCapabilities returns the capabilities of the controller
 func (d *Driver) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
 	newCap := func(cap csi.ControllerServiceCapability_RPC_Type) *csi.ControllerServiceCapability {
@@ -76,7 +112,7 @@ func (d *Driver) ControllerGetCapabilities(ctx context.Context, req *csi.Control
 		}
 	}
 
-	caps := make([]*csi.ControllerServiceCapability, 0, 7)
+	caps := make([]*csi.ControllerServiceCapability, 0, 9)
 	for _, cap := range []csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
@@ -85,6 +121,8 @@ func (d *Driver) ControllerGetCapabilities(ctx context.Context, req *csi.Control
 		csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
 		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
 		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+		csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
 	} {
 		caps = append(caps, newCap(cap))
 	}
@@ -101,7 +139,8 @@ func (d *Driver) ControllerGetCapabilities(ctx context.Context, req *csi.Control
 func validateCapabilities(caps []*csi.VolumeCapability) []string {
 	violations := sets.NewString()
 	for _, cap := range caps {
-		if cap.GetAccessMode().GetMode() != supportedAccessMode.GetMode() {
+		mode := cap.GetAccessMode().GetMode()
+		if !slices.Contains(supportedAccessModes, mode) && !slices.Contains(readOnlyAccessModes, mode) {
 			violations.Insert(fmt.Sprintf("unsupported access mode %s", cap.GetAccessMode().GetMode().String()))
 		}
 
@@ -116,3 +155,52 @@ func validateCapabilities(caps []*csi.VolumeCapability) []string {
 
 	return violations.List()
 }
+
+// isReadOnlyAccessMode returns whether the access mode only allows reading
+// the volume.
+func isReadOnlyAccessMode(mode *csi.VolumeCapability_AccessMode) bool {
+	return slices.Contains(readOnlyAccessModes, mode.GetMode())
+}
+
+// isMultiNodeCapability returns whether any of the capabilities requires the
+// volume to be attached to multiple machines.
+func isMultiNodeCapability(caps ...*csi.VolumeCapability) bool {
+	for _, cap := range caps {
+		if cap.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsMultiAttach returns whether the volume type, given by its identity
+// or name, can be attached to multiple machines. The API does not report
+// this, so it is configured with --multi-attach-volume-types.
+func (d *Driver) allowsMultiAttach(volumeType ...string) bool {
+	return volumeTypeListed(d.multiAttachVolumeTypes, volumeType...)
+}
+
+// volumeTypeListed returns whether the volume type, given by its identity or
+// name, is in the list of volume types.
+func volumeTypeListed(types []string, volumeType ...string) bool {
+	for _, listed := range types {
+		for _, vt := range volumeType {
+			if vt != "" && strings.EqualFold(listed, vt) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseVolumeTypes parses a comma separated list of volume type identities
+// or names.
+func parseVolumeTypes(s string) []string {
+	var volumeTypes []string
+	for _, vt := range strings.Split(s, ",") {
+		if vt = strings.TrimSpace(vt); vt != "" {
+			volumeTypes = append(volumeTypes, vt)
+		}
+	}
+	return volumeTypes
+}
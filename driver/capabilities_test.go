@@ -0,0 +1,230 @@
+package driver
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+	"github.com/thalassa-cloud/client-go/iaas"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateCapabilities(t *testing.T) {
+	capability := func(mode csi.VolumeCapability_AccessMode_Mode) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		caps           []*csi.VolumeCapability
+		wantViolations []string
+	}{
+		{
+			name: "single node writer",
+			caps: []*csi.VolumeCapability{capability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER)},
+		},
+		{
+			name: "single node single and multi writer",
+			caps: []*csi.VolumeCapability{
+				capability(csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER),
+				capability(csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER),
+			},
+		},
+		{
+			name: "read only modes",
+			caps: []*csi.VolumeCapability{
+				capability(csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY),
+				capability(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY),
+			},
+		},
+		{
+			name:           "multi node writer",
+			caps:           []*csi.VolumeCapability{capability(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER)},
+			wantViolations: []string{"unsupported access mode MULTI_NODE_MULTI_WRITER"},
+		},
+		{
+			name: "missing access type",
+			caps: []*csi.VolumeCapability{{
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+			}},
+			wantViolations: []string{"unsupported access type"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := validateCapabilities(tt.caps)
+			if len(tt.wantViolations) == 0 {
+				require.Empty(t, violations)
+				return
+			}
+			require.Equal(t, tt.wantViolations, violations)
+		})
+	}
+}
+
+func TestAllowsMultiAttach(t *testing.T) {
+	d := &Driver{multiAttachVolumeTypes: parseVolumeTypes(" shared, vt-1234 ,")}
+
+	require.Equal(t, []string{"shared", "vt-1234"}, d.multiAttachVolumeTypes)
+	require.True(t, d.allowsMultiAttach("vt-5678", "Shared"))
+	require.True(t, d.allowsMultiAttach("vt-1234", ""))
+	require.False(t, d.allowsMultiAttach("vt-5678", "block"))
+	require.False(t, (&Driver{}).allowsMultiAttach("vt-1234", "shared"))
+}
+
+func TestGetCapabilitiesSingleNodeMultiWriter(t *testing.T) {
+	d := &Driver{log: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	controllerCaps, err := d.ControllerGetCapabilities(context.Background(), &csi.ControllerGetCapabilitiesRequest{})
+	require.NoError(t, err)
+	var controllerTypes []csi.ControllerServiceCapability_RPC_Type
+	for _, cap := range controllerCaps.Capabilities {
+		controllerTypes = append(controllerTypes, cap.GetRpc().GetType())
+	}
+	require.Contains(t, controllerTypes, csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER)
+
+	nodeCaps, err := d.NodeGetCapabilities(context.Background(), &csi.NodeGetCapabilitiesRequest{})
+	require.NoError(t, err)
+	var nodeTypes []csi.NodeServiceCapability_RPC_Type
+	for _, cap := range nodeCaps.Capabilities {
+		nodeTypes = append(nodeTypes, cap.GetRpc().GetType())
+	}
+	require.Contains(t, nodeTypes, csi.NodeServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER)
+}
+
+func TestValidateVolumeCapabilities(t *testing.T) {
+	mountCap := func(mode csi.VolumeCapability_AccessMode_Mode, fsType string, flags ...string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{FsType: fsType, MountFlags: flags},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+		}
+	}
+	blockCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER},
+	}
+
+	volumes := map[string]*iaas.Volume{
+		"vol-block":  {Identity: "vol-block", VolumeType: &iaas.VolumeType{Identity: "vt-block", Name: "block"}},
+		"vol-shared": {Identity: "vol-shared", VolumeType: &iaas.VolumeType{Identity: "vt-shared", Name: "shared"}},
+	}
+
+	tests := []struct {
+		name        string
+		req         *csi.ValidateVolumeCapabilitiesRequest
+		wantMessage string
+		wantErr     error
+	}{
+		{
+			name: "mount capability with flags and parameters",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           "vol-block",
+				VolumeCapabilities: []*csi.VolumeCapability{mountCap(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, "xfs", "noatime")},
+				VolumeContext:      map[string]string{fsCheckParameter: "true"},
+				Parameters:         map[string]string{"volume-type": "block", xfsReflinkParameter: "true"},
+			},
+		},
+		{
+			name: "block capability",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           "vol-block",
+				VolumeCapabilities: []*csi.VolumeCapability{blockCap},
+			},
+		},
+		{
+			name: "multi node reader on a multi-attach volume type",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           "vol-shared",
+				VolumeCapabilities: []*csi.VolumeCapability{mountCap(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY, "ext4")},
+			},
+		},
+		{
+			name: "multi node reader on a single attach volume type",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           "vol-block",
+				VolumeCapabilities: []*csi.VolumeCapability{mountCap(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY, "ext4")},
+			},
+			wantMessage: "volume capabilities cannot be satisified: the volume type cannot be attached to multiple machines",
+		},
+		{
+			name: "multi node writer",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           "vol-block",
+				VolumeCapabilities: []*csi.VolumeCapability{mountCap(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER, "ext4")},
+			},
+			wantMessage: "volume capabilities cannot be satisified: unsupported access mode MULTI_NODE_MULTI_WRITER",
+		},
+		{
+			name: "unsupported fs type",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           "vol-block",
+				VolumeCapabilities: []*csi.VolumeCapability{mountCap(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, "ntfs")},
+			},
+			wantMessage: `unsupported fs type "ntfs", supported fs types are: ext3, ext4, xfs, btrfs`,
+		},
+		{
+			name: "parameters for another fs type",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           "vol-block",
+				VolumeCapabilities: []*csi.VolumeCapability{mountCap(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, "xfs")},
+				Parameters:         map[string]string{bytesPerInodeParameter: "4096"},
+			},
+			wantMessage: `invalid filesystem parameters: parameter "bytes-per-inode" is only supported for ext3 and ext4, not "xfs"`,
+		},
+		{
+			name: "missing capabilities",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId: "vol-block",
+			},
+			wantErr: status.Error(codes.InvalidArgument, "ValidateVolumeCapabilities Volume Capabilities must be provided"),
+		},
+		{
+			name: "missing volume",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId:           "vol-missing",
+				VolumeCapabilities: []*csi.VolumeCapability{blockCap},
+			},
+			wantErr: status.Error(codes.NotFound, `volume "vol-missing" does not exist`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, iaasClient := newFakeAPI(t, volumes)
+			d := &Driver{
+				log:                    slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				iaas:                   iaasClient,
+				multiAttachVolumeTypes: []string{"shared"},
+			}
+
+			resp, err := d.ValidateVolumeCapabilities(context.Background(), tt.req)
+			if tt.wantErr != nil {
+				require.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.wantMessage != "" {
+				require.Nil(t, resp.Confirmed)
+				require.Equal(t, tt.wantMessage, resp.Message)
+				return
+			}
+			require.Empty(t, resp.Message)
+			require.Equal(t, tt.req.VolumeCapabilities, resp.Confirmed.VolumeCapabilities)
+			require.Equal(t, tt.req.VolumeContext, resp.Confirmed.VolumeContext)
+			require.Equal(t, tt.req.Parameters, resp.Confirmed.Parameters)
+		})
+	}
+}
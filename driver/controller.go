@@ -50,6 +50,12 @@ type Driver struct {
 	// publishInfoVolumeName is used to pass the volume name from
 	// `ControllerPublishVolume` to `NodeStageVolume or `NodePublishVolume`
 	publishInfoVolumeName string
+	// publishInfoSerial, publishInfoAttachment and publishInfoBus are used
+	// to pass the serial, identity and bus of the volume attachment to the
+	// node, so it can find the device of the volume
+	publishInfoSerial     string
+	publishInfoAttachment string
+	publishInfoBus        string
 
 	endpoint               string
 	debugAddr              string
@@ -59,6 +65,26 @@ type Driver struct {
 
 	validateAttachment bool
 
+	// waitForSnapshotReady makes CreateSnapshot block until the snapshot is
+	// available instead of letting the snapshotter poll for it
+	waitForSnapshotReady bool
+
+	// multiAttachVolumeTypes lists the identities or names of the volume
+	// types that can be attached to multiple machines, which is required
+	// for MULTI_NODE_READER_ONLY
+	multiAttachVolumeTypes []string
+
+	// offlineResizeVolumeTypes lists the identities or names of the volume
+	// types that can only be resized while they are not attached
+	offlineResizeVolumeTypes []string
+
+	// ephemeralVolumeTypes lists the volume types the node plugin may create
+	// inline ephemeral volumes with, ephemeralMaxSize is their maximum size
+	// in bytes and ephemeralSweepInterval how often leaked ones are deleted
+	ephemeralVolumeTypes   []string
+	ephemeralMaxSize       int64
+	ephemeralSweepInterval time.Duration
+
 	vpc             string
 	clusterIdentity string
 	projectId       string
@@ -72,6 +98,20 @@ type Driver struct {
 
 	healthChecker *healthcheck.HealthChecker
 
+	// eventRecorder records events for the PVCs of volumes, it is only set
+	// for the node plugin
+	eventRecorder eventRecorder
+
+	// propagationMode and kubeletDir are used by the node plugin to check
+	// the mount propagation of the kubelet directories
+	propagationMode propagationMode
+	kubeletDir      string
+
+	// volumeConditions holds the outcome of the filesystem check of the
+	// staged volumes, reported by NodeGetVolumeStats
+	volumeConditionsMu sync.Mutex
+	volumeConditions   map[string]*csi.VolumeCondition
+
 	// ready defines whether the driver is ready to function. This value will
 	// be used by the `Identity` service via the `Probe()` method.
 	readyMu     sync.Mutex // protects ready
@@ -104,6 +144,19 @@ type NewDriverParams struct {
 	VolumeLimit uint
 	NodeID      string
 	KubeConfig  string
+
+	CustomLabels      string
+	CustomAnnotations string
+
+	WaitForSnapshotReady bool
+
+	// MultiAttachVolumeTypes is a comma separated list of the volume types
+	// that can be attached to multiple machines
+	MultiAttachVolumeTypes string
+
+	// OfflineResizeVolumeTypes is a comma separated list of the volume types
+	// that can only be resized while they are not attached
+	OfflineResizeVolumeTypes string
 }
 
 // NewDriver returns a CSI plugin that contains the necessary gRPC
@@ -121,33 +174,90 @@ func NewDriver(p NewDriverParams) (*Driver, error) {
 	log := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	log = log.With("region", region, "node_id", nodeId, "version", version.GetVersion())
 
+	iaasClient, err := newIaasClient(log, apiClientParams{
+		URL:          p.ThalassaURL,
+		Organisation: p.ThalassaOrganisation,
+		Project:      p.ThalassaProject,
+		Token:        p.ThalassaToken,
+		ClientID:     p.ThalassaClientID,
+		ClientSecret: p.ThalassaClientSecret,
+		Insecure:     p.ThalassaInsecure,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	healthChecker := healthcheck.NewHealthChecker(&tcHealthChecker{
+		iaas:   iaasClient,
+		region: region,
+	})
+
+	return &Driver{
+		name:                     driverName,
+		publishInfoVolumeName:    driverName + "/volume-name",
+		publishInfoSerial:        driverName + "/serial",
+		publishInfoAttachment:    driverName + "/attachment-identity",
+		publishInfoBus:           driverName + "/bus",
+		endpoint:                 p.CsiEndpoint,
+		debugAddr:                p.DebugAddr,
+		volumeLimit:              p.VolumeLimit,
+		nodeID:                   nodeId,
+		region:                   region,
+		log:                      log,
+		iaas:                     iaasClient,
+		healthChecker:            healthChecker,
+		vpc:                      p.Vpc,
+		clusterIdentity:          p.Cluster,
+		projectId:                p.ThalassaProject,
+		CustomLabels:             parseCustomLabels(p.CustomLabels),
+		CustomAnnotations:        parseCustomLabels(p.CustomAnnotations),
+		waitForSnapshotReady:     p.WaitForSnapshotReady,
+		multiAttachVolumeTypes:   parseVolumeTypes(p.MultiAttachVolumeTypes),
+		offlineResizeVolumeTypes: parseVolumeTypes(p.OfflineResizeVolumeTypes),
+	}, nil
+}
+
+// apiClientParams defines the parameters of the Thalassa Cloud API client.
+type apiClientParams struct {
+	URL          string
+	Organisation string
+	Project      string
+	Token        string
+	ClientID     string
+	ClientSecret string
+	Insecure     bool
+}
+
+// newIaasClient returns a Thalassa IaaS client, authenticated with OIDC
+// client credentials or a personal token.
+func newIaasClient(log *slog.Logger, p apiClientParams) (*iaas.Client, error) {
 	userAgent := fmt.Sprintf("github.com/thalassa-cloud/csi-thalassa/%s", version.GetVersion())
 
 	opts := []client.Option{
-		client.WithBaseURL(p.ThalassaURL),
-		client.WithOrganisation(p.ThalassaOrganisation),
+		client.WithBaseURL(p.URL),
+		client.WithOrganisation(p.Organisation),
 		client.WithUserAgent(userAgent),
 	}
 
-	if p.ThalassaInsecure {
+	if p.Insecure {
 		log.Warn("Insecure mode for API access enabled. Only use this in development environments.")
 		opts = append(opts, client.WithInsecure())
 	}
 
-	if p.ThalassaProject != "" {
-		opts = append(opts, client.WithProject(p.ThalassaProject))
+	if p.Project != "" {
+		opts = append(opts, client.WithProject(p.Project))
 	}
 
-	if p.ThalassaClientID != "" && p.ThalassaClientSecret != "" {
+	if p.ClientID != "" && p.ClientSecret != "" {
 		log.Info("Using OIDC for API access")
-		if p.ThalassaInsecure {
-			opts = append(opts, client.WithAuthOIDCInsecure(p.ThalassaClientID, p.ThalassaClientSecret, fmt.Sprintf("%s/oidc/token", p.ThalassaURL), p.ThalassaInsecure))
+		if p.Insecure {
+			opts = append(opts, client.WithAuthOIDCInsecure(p.ClientID, p.ClientSecret, fmt.Sprintf("%s/oidc/token", p.URL), p.Insecure))
 		} else {
-			opts = append(opts, client.WithAuthOIDC(p.ThalassaClientID, p.ThalassaClientSecret, fmt.Sprintf("%s/oidc/token", p.ThalassaURL)))
+			opts = append(opts, client.WithAuthOIDC(p.ClientID, p.ClientSecret, fmt.Sprintf("%s/oidc/token", p.URL)))
 		}
-	} else if p.ThalassaToken != "" {
+	} else if p.Token != "" {
 		log.Warn("Using personal token for API access. Only use this in development environments. Prefer using OIDC.")
-		opts = append(opts, client.WithAuthPersonalToken(p.ThalassaToken))
+		opts = append(opts, client.WithAuthPersonalToken(p.Token))
 	} else {
 		log.Warn("No authentication method provided. This may only work in development environments")
 	}
@@ -162,27 +272,7 @@ func NewDriver(p NewDriverParams) (*Driver, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize Thalassa IaaS client: %s", err)
 	}
-
-	healthChecker := healthcheck.NewHealthChecker(&tcHealthChecker{
-		iaas:   iaasClient,
-		region: region,
-	})
-
-	return &Driver{
-		name:                  driverName,
-		publishInfoVolumeName: driverName + "/volume-name",
-		endpoint:              p.CsiEndpoint,
-		debugAddr:             p.DebugAddr,
-		volumeLimit:           p.VolumeLimit,
-		nodeID:                nodeId,
-		region:                region,
-		log:                   log,
-		iaas:                  iaasClient,
-		healthChecker:         healthChecker,
-		vpc:                   p.Vpc,
-		clusterIdentity:       p.Cluster,
-		projectId:             p.ThalassaProject,
-	}, nil
+	return iaasClient, nil
 }
 
 // Run starts the CSI plugin by communication over the given endpoint
@@ -45,11 +45,9 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 		return nil, status.Error(codes.InvalidArgument, "ControllerPublishVolume Volume capability must be provided")
 	}
 
-	if req.Readonly {
-		return nil, status.Error(codes.InvalidArgument, "read only volumes are not supported")
-	}
-
-	log := d.log.With("volume_id", req.VolumeId, "node_id", req.NodeId, "method", "controller_publish_volume")
+	// volumes are always attached read-write, read only volumes are mounted
+	// read only by the node
+	log := d.log.With("volume_id", req.VolumeId, "node_id", req.NodeId, "readonly", req.Readonly, "method", "controller_publish_volume")
 	log.Info("controller publish volume called")
 
 	// check if volume exist before trying to attach it
@@ -109,20 +107,25 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 		if attachment.AttachedToIdentity == attachToIdentity {
 			log.Info("volume is already attached")
 			return &csi.ControllerPublishVolumeResponse{
-				PublishContext: map[string]string{
-					d.publishInfoVolumeName: vol.Name,
-				},
+				PublishContext: d.publishContext(vol, &attachment),
 			}, nil
 		}
 	}
 
-	// machine is attached to a different node, return an error
+	// machine is attached to a different node, return an error unless the
+	// volume is read by multiple nodes and its type can be attached to
+	// multiple machines
 	if attachedToMachine != "" {
-		return nil, status.Errorf(codes.FailedPrecondition, "volume %q is attached to the wrong machine (%q), detach the volume to fix it", req.VolumeId, attachedToMachine)
+		multiAttach := isMultiNodeCapability(req.VolumeCapability) && vol.VolumeType != nil &&
+			d.allowsMultiAttach(vol.VolumeType.Identity, vol.VolumeType.Name)
+		if !multiAttach {
+			return nil, status.Errorf(codes.FailedPrecondition, "volume %q is attached to the wrong machine (%q), detach the volume to fix it", req.VolumeId, attachedToMachine)
+		}
+		log.Info("volume is attached to another machine, attaching it read only to this machine as well", "attached_to", attachedToMachine)
 	}
 
 	// attach the volume to the correct node
-	_, err = d.iaas.AttachVolume(ctx, req.VolumeId, iaas.AttachVolumeRequest{
+	attachment, err := d.iaas.AttachVolume(ctx, req.VolumeId, iaas.AttachVolumeRequest{
 		ResourceIdentity: attachToIdentity,
 		ResourceType:     "cloud_virtual_machine",
 	})
@@ -140,7 +143,9 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 			return false, fmt.Errorf("error getting volume: %w", err)
 		}
 		log.Info("volume status", "status", vol.Status)
-		if strings.EqualFold(vol.Status, "attached") {
+		// the serial may only be known once the volume is attached
+		if a := findAttachment(vol, attachToIdentity); a != nil && strings.EqualFold(vol.Status, "attached") {
+			attachment = a
 			return true, nil
 		}
 		return false, nil
@@ -150,12 +155,42 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 
 	log.Info("volume was attached")
 	return &csi.ControllerPublishVolumeResponse{
-		PublishContext: map[string]string{
-			d.publishInfoVolumeName: vol.Name,
-		},
+		PublishContext: d.publishContext(vol, attachment),
 	}, nil
 }
 
+// findAttachment returns the attachment of the volume to the machine.
+func findAttachment(vol *iaas.Volume, machineIdentity string) *iaas.VolumeAttachment {
+	for i := range vol.Attachments {
+		if vol.Attachments[i].AttachedToIdentity == machineIdentity {
+			return &vol.Attachments[i]
+		}
+	}
+	return nil
+}
+
+// publishContext returns the publish context for the node, with the
+// attachment details the node uses to find the device of the volume.
+func (d *Driver) publishContext(vol *iaas.Volume, attachment *iaas.VolumeAttachment) map[string]string {
+	publishContext := map[string]string{
+		d.publishInfoVolumeName: vol.Name,
+	}
+	if attachment == nil {
+		return publishContext
+	}
+
+	if attachment.Serial != "" {
+		publishContext[d.publishInfoSerial] = attachment.Serial
+	}
+	if attachment.Identity != "" {
+		publishContext[d.publishInfoAttachment] = attachment.Identity
+	}
+	// the API does not report the bus, Thalassa Cloud attaches volumes to
+	// virtual machines as SCSI disks
+	publishContext[d.publishInfoBus] = busSCSI
+	return publishContext
+}
+
 // ControllerUnpublishVolume deattaches the given volume from the node
 func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
 	if req.VolumeId == "" {
@@ -255,6 +290,10 @@ func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.Control
 		if strings.EqualFold(vol.Status, "available") {
 			return true, nil
 		}
+		// volumes attached to multiple machines stay attached to the others
+		if len(vol.Attachments) > 0 && findAttachment(vol, attachToIdentity) == nil {
+			return true, nil
+		}
 		return false, nil
 	}); err != nil {
 		if client.IsNotFound(err) {
@@ -0,0 +1,35 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/thalassa-cloud/client-go/iaas"
+)
+
+func TestPublishContext(t *testing.T) {
+	d := &Driver{
+		publishInfoVolumeName: "csi.k8s.thalassa.cloud/volume-name",
+		publishInfoSerial:     "csi.k8s.thalassa.cloud/serial",
+		publishInfoAttachment: "csi.k8s.thalassa.cloud/attachment-identity",
+		publishInfoBus:        "csi.k8s.thalassa.cloud/bus",
+	}
+	vol := &iaas.Volume{
+		Name: "pvc-1234",
+		Attachments: []iaas.VolumeAttachment{
+			{Identity: "va-1", Serial: "serial-1", AttachedToIdentity: "vm-1"},
+			{Identity: "va-2", Serial: "serial-2", AttachedToIdentity: "vm-2"},
+		},
+	}
+
+	require.Equal(t, map[string]string{
+		"csi.k8s.thalassa.cloud/volume-name": "pvc-1234",
+	}, d.publishContext(vol, findAttachment(vol, "vm-3")))
+
+	require.Equal(t, map[string]string{
+		"csi.k8s.thalassa.cloud/volume-name":         "pvc-1234",
+		"csi.k8s.thalassa.cloud/serial":              "serial-2",
+		"csi.k8s.thalassa.cloud/attachment-identity": "va-2",
+		"csi.k8s.thalassa.cloud/bus":                 "scsi",
+	}, d.publishContext(vol, findAttachment(vol, "vm-2")))
+}
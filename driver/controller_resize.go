@@ -22,6 +22,7 @@ import (
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/thalassa-cloud/client-go/iaas"
+	"github.com/thalassa-cloud/client-go/pkg/client"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -44,36 +45,81 @@ func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.Controller
 
 	volume, err := d.iaas.GetVolume(ctx, volumeId)
 	if err != nil {
+		if client.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "ControllerExpandVolume volume %s not found", volumeId)
+		}
 		return nil, status.Errorf(codes.Internal, "ControllerExpandVolume could not retrieve existing volume: %v", err)
 	}
 
 	if isVolumeSizeEuqalOrLargerThanRequested(volume, resizeGigaBytes) {
 		log.With("current_volume_size", volume.Size, "requested_volume_size", resizeGigaBytes).Info("no resize necessary because API volume size is equal or larger than requested volume size")
+		// a previous call may have resized the volume before the node
+		// expanded it
 		return &csi.ControllerExpandVolumeResponse{CapacityBytes: int64(volume.Size) * giB, NodeExpansionRequired: true}, nil
 	}
 
-	if _, err := d.iaas.UpdateVolume(ctx, volumeId, iaas.UpdateVolume{
-		Name:             volume.Name,
-		Description:      volume.Description,
-		Labels:           volume.Labels,
-		Annotations:      volume.Annotations,
-		Size:             int(resizeGigaBytes),
-		DeleteProtection: volume.DeleteProtection,
-	}); err != nil {
+	if err := d.checkVolumeResizable(ctx, volume); err != nil {
+		return nil, err
+	}
+
+	// only the size is changed, the other fields are taken from the volume
+	// as it is right before the update
+	updated, err := d.updateVolume(ctx, volumeId, func(vol *iaas.Volume) (*iaas.UpdateVolume, error) {
+		if isVolumeSizeEuqalOrLargerThanRequested(vol, resizeGigaBytes) {
+			return nil, nil
+		}
+		update := newVolumeUpdate(vol)
+		update.Size = int(resizeGigaBytes)
+		return update, nil
+	})
+	if err != nil {
+		if client.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "ControllerExpandVolume volume %s not found", volumeId)
+		}
 		return nil, status.Errorf(codes.Internal, "cannot resize volume %s: %s", volumeId, err.Error())
 	}
+	if updated != nil && int64(updated.Size) > resizeGigaBytes {
+		resizeGigaBytes = int64(updated.Size)
+	}
 
 	log = log.With("new_volume_size", resizeGigaBytes)
 	log.Info("volume was resized")
 
-	nodeExpansionRequired := true
-	if req.GetVolumeCapability() != nil {
-		if _, ok := req.GetVolumeCapability().GetAccessType().(*csi.VolumeCapability_Block); ok {
-			log.Debug("node expansion is not required for block volumes")
-			nodeExpansionRequired = false
-		}
+	// the node rescans the device of block volumes and grows the filesystem
+	// of mounted volumes
+	return &csi.ControllerExpandVolumeResponse{CapacityBytes: resizeGigaBytes * giB, NodeExpansionRequired: true}, nil
+}
+
+// checkVolumeResizable returns a FailedPrecondition error when the volume
+// type of the volume does not allow resizing, or only allows it while the
+// volume is not attached.
+func (d *Driver) checkVolumeResizable(ctx context.Context, volume *iaas.Volume) error {
+	if volume.VolumeType == nil || volume.VolumeType.Identity == "" {
+		return nil
 	}
-	return &csi.ControllerExpandVolumeResponse{CapacityBytes: resizeGigaBytes * giB, NodeExpansionRequired: nodeExpansionRequired}, nil
+
+	// the volume type of the volume may not include all fields
+	volumeType, err := d.iaas.GetVolumeType(ctx, volume.VolumeType.Identity)
+	if err != nil {
+		return status.Errorf(codes.Internal, "ControllerExpandVolume could not retrieve volume type %s: %v", volume.VolumeType.Identity, err)
+	}
+
+	if !volumeType.AllowResize {
+		return status.Errorf(codes.FailedPrecondition, "volume type %q of volume %s can not be resized", volumeType.Name, volume.Identity)
+	}
+
+	if len(volume.Attachments) > 0 && d.requiresOfflineResize(volumeType.Identity, volumeType.Name) {
+		return status.Errorf(codes.FailedPrecondition, "volume type %q of volume %s can only be resized while the volume is not attached", volumeType.Name, volume.Identity)
+	}
+	return nil
+}
+
+// requiresOfflineResize returns whether the volume type, given by its
+// identity or name, can only be resized while it is not attached. The API
+// does not report this, so it is configured with
+// --offline-resize-volume-types.
+func (d *Driver) requiresOfflineResize(volumeType ...string) bool {
+	return volumeTypeListed(d.offlineResizeVolumeTypes, volumeType...)
 }
 
 // isVolumeSizeEuqalOrLargerThanRequested checks if the volume size is equal or larger than the requested size
@@ -0,0 +1,138 @@
+package driver
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+	"github.com/thalassa-cloud/client-go/iaas"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestControllerExpandVolume(t *testing.T) {
+	volumeTypes := map[string]*iaas.VolumeType{
+		"vt-block":  {Identity: "vt-block", Name: "block", AllowResize: true},
+		"vt-fixed":  {Identity: "vt-fixed", Name: "fixed"},
+		"vt-legacy": {Identity: "vt-legacy", Name: "legacy", AllowResize: true},
+	}
+	blockCapability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+	}
+	attachments := []iaas.VolumeAttachment{{Identity: "va-1", AttachedToIdentity: "vm-1"}}
+
+	tests := []struct {
+		name                      string
+		volumeType                string
+		size                      int
+		attachments               []iaas.VolumeAttachment
+		capability                *csi.VolumeCapability
+		wantCode                  codes.Code
+		wantCapacity              int64
+		wantUpdatedSize           int
+		wantNodeExpansionRequired bool
+	}{
+		{
+			name:                      "resize",
+			volumeType:                "vt-block",
+			size:                      10,
+			attachments:               attachments,
+			wantCapacity:              20 * giB,
+			wantUpdatedSize:           20,
+			wantNodeExpansionRequired: true,
+		},
+		{
+			name:                      "resize block volume",
+			volumeType:                "vt-block",
+			size:                      10,
+			attachments:               attachments,
+			capability:                blockCapability,
+			wantCapacity:              20 * giB,
+			wantUpdatedSize:           20,
+			wantNodeExpansionRequired: true,
+		},
+		{
+			name:                      "block volume already resized",
+			volumeType:                "vt-fixed",
+			size:                      20,
+			capability:                blockCapability,
+			wantCapacity:              20 * giB,
+			wantNodeExpansionRequired: true,
+		},
+		{
+			name:       "volume type does not allow resizing",
+			volumeType: "vt-fixed",
+			size:       10,
+			wantCode:   codes.FailedPrecondition,
+		},
+		{
+			name:        "offline resize of attached volume",
+			volumeType:  "vt-legacy",
+			size:        10,
+			attachments: attachments,
+			wantCode:    codes.FailedPrecondition,
+		},
+		{
+			name:                      "offline resize of detached volume",
+			volumeType:                "vt-legacy",
+			size:                      10,
+			wantCapacity:              20 * giB,
+			wantUpdatedSize:           20,
+			wantNodeExpansionRequired: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volume := &iaas.Volume{
+				Identity:    "vol-1",
+				Name:        "vol-1",
+				Size:        tt.size,
+				VolumeType:  &iaas.VolumeType{Identity: tt.volumeType},
+				Attachments: tt.attachments,
+			}
+			api, iaasClient := newFakeAPI(t, map[string]*iaas.Volume{volume.Identity: volume})
+			api.volumeTypes = volumeTypes
+
+			driver := &Driver{
+				iaas:                     iaasClient,
+				log:                      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				offlineResizeVolumeTypes: []string{"legacy"},
+			}
+
+			resp, err := driver.ControllerExpandVolume(context.Background(), &csi.ControllerExpandVolumeRequest{
+				VolumeId:         "vol-1",
+				CapacityRange:    &csi.CapacityRange{RequiredBytes: 20 * giB},
+				VolumeCapability: tt.capability,
+			})
+			updatedSize := 0
+			for _, update := range api.Updates() {
+				updatedSize = update.Size
+			}
+			require.Equal(t, tt.wantUpdatedSize, updatedSize)
+			if tt.wantCode != codes.OK {
+				require.Equal(t, tt.wantCode, status.Code(err), err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCapacity, resp.CapacityBytes)
+			require.Equal(t, tt.wantNodeExpansionRequired, resp.NodeExpansionRequired)
+		})
+	}
+
+	t.Run("volume not found", func(t *testing.T) {
+		_, iaasClient := newFakeAPI(t, nil)
+		driver := &Driver{
+			iaas: iaasClient,
+			log:  slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		}
+		_, err := driver.ControllerExpandVolume(context.Background(), &csi.ControllerExpandVolumeRequest{
+			VolumeId:      "vol-missing",
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 20 * giB},
+		})
+		require.Equal(t, codes.NotFound, status.Code(err), err)
+	})
+}
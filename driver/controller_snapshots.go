@@ -18,6 +18,7 @@ package driver
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 
@@ -27,6 +28,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 // CreateSnapshot creates a new snapshot from a source volume.
@@ -50,13 +52,22 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 	if snapshot == nil {
 		return nil, status.Error(codes.NotFound, "snapshot not found or not created")
 	}
-	log.With("snapshot_identity", snapshot.Identity).Info("waiting for snapshot to be ready")
-	// wait for the snapshot to be ready
-	if err := d.iaas.WaitUntilSnapshotIsAvailable(ctx, snapshot.Identity); err != nil {
-		log.With("snapshot_identity", snapshot.Identity).Error("failed to wait for snapshot to be ready", "error", err)
-		return nil, status.Error(codes.Internal, err.Error())
+
+	if d.waitForSnapshotReady {
+		log.With("snapshot_identity", snapshot.Identity).Info("waiting for snapshot to be ready")
+		// wait for the snapshot to be ready
+		if err := d.waitUntilSnapshotIsDone(ctx, snapshot.Identity); err != nil {
+			log.With("snapshot_identity", snapshot.Identity).Error("failed to wait for snapshot to be ready", "error", err)
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		log.With("snapshot_identity", snapshot.Identity).Info("finished waiting for snapshot")
+	} else {
+		// the snapshotter polls the snapshot until it is ready to use
+		log.With("snapshot_identity", snapshot.Identity, "snapshot_status", snapshot.Status).Info("returning snapshot without waiting for it to be ready")
 	}
-	log.With("snapshot_identity", snapshot.Identity).Info("snapshot is ready")
+
+	// the response of the create request may not include the source volume
+	// and size of the snapshot
 	snapshot, err = d.iaas.GetSnapshot(ctx, snapshot.Identity)
 	if err != nil {
 		if client.IsNotFound(err) {
@@ -64,6 +75,10 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	if snapshot.Status == iaas.SnapshotStatusFailed {
+		log.With("snapshot_identity", snapshot.Identity).Error("snapshot is in a failed state")
+		return nil, status.Errorf(codes.Internal, "snapshot %q is in a failed state", snapshot.Identity)
+	}
 
 	log.With("snapshot_identity", snapshot.Identity).Info("mapping snapshot to CSI snapshot")
 	mapped, err := mapToCSISnapshot(snapshot)
@@ -71,11 +86,27 @@ func (d *Driver) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequ
 		log.With("snapshot_identity", snapshot.Identity).Error("failed to map snapshot to CSI snapshot", "error", err)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	if mapped.SourceVolumeId == "" {
+		mapped.SourceVolumeId = req.GetSourceVolumeId()
+	}
 	return &csi.CreateSnapshotResponse{
 		Snapshot: mapped,
 	}, nil
 }
 
+// waitUntilSnapshotIsDone waits until the snapshot is available or failed,
+// so a failed snapshot is reported right away instead of when the request
+// times out.
+func (d *Driver) waitUntilSnapshotIsDone(ctx context.Context, snapshotIdentity string) error {
+	return wait.PollUntilContextCancel(ctx, iaas.DefaultPollIntervalForWaiting, true, func(ctx context.Context) (bool, error) {
+		snapshot, err := d.iaas.GetSnapshot(ctx, snapshotIdentity)
+		if err != nil {
+			return false, err
+		}
+		return snapshot.Status == iaas.SnapshotStatusAvailable || snapshot.Status == iaas.SnapshotStatusFailed, nil
+	})
+}
+
 func (d *Driver) getOrCreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*iaas.Snapshot, error) {
 	log := d.log.With("req_name", req.GetName(), "req_source_volume_id", req.GetSourceVolumeId(), "req_parameters", req.GetParameters(), "method", "get_or_create_snapshot")
 	log.Info("getting or creating snapshot")
@@ -126,6 +157,21 @@ func (d *Driver) getOrCreateSnapshot(ctx context.Context, req *csi.CreateSnapsho
 	log = log.With("resolved_volume_identity", volumeIdentity)
 	log.Info("resolved volume identity for snapshot creation")
 
+	createReq, err := d.buildCreateSnapshotRequest(req, volumeIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := d.iaas.CreateSnapshot(ctx, createReq)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return snapshot, nil
+}
+
+func (d *Driver) buildCreateSnapshotRequest(req *csi.CreateSnapshotRequest, volumeIdentity string) (iaas.CreateSnapshotRequest, error) {
+	params := req.GetParameters()
+
 	labels := iaas.Labels{
 		"csi.volume.id":                      req.GetSourceVolumeId(),
 		"k8s.thalassa.cloud/csi-driver":      "true",
@@ -135,32 +181,54 @@ func (d *Driver) getOrCreateSnapshot(ctx context.Context, req *csi.CreateSnapsho
 		"csi.snapshot.id":                req.GetName(),
 		"k8s.thalassa.cloud/description": "Provisioned by Thalassa CSI driver",
 	}
-	for k, v := range d.CustomLabels {
-		if _, ok := labels[k]; !ok {
-			labels[k] = v
-		}
-	}
-	for k, v := range d.CustomAnnotations {
-		if _, ok := annotations[k]; !ok {
-			annotations[k] = v
-		}
-	}
 
 	if d.clusterIdentity != "" {
 		labels["k8s.thalassa.cloud/cluster-identity"] = d.clusterIdentity
 	}
 
-	snapshot, err := d.iaas.CreateSnapshot(ctx, iaas.CreateSnapshotRequest{
-		Name:           req.GetName(),
-		VolumeIdentity: volumeIdentity,
-		Labels:         labels,
-		Annotations:    annotations,
-	})
+	// precedence: driver labels, snapshot metadata labels, snapshot class
+	// parameters and finally the global custom labels and annotations
+	mergeMissing(labels, createMetadataLabels(params))
 
+	classLabels, err := parseMetadataParameter(labelsParameter, params)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return iaas.CreateSnapshotRequest{}, status.Errorf(codes.InvalidArgument, "invalid snapshot labels: %v", err)
 	}
-	return snapshot, nil
+	mergeMissing(labels, classLabels)
+
+	classAnnotations, err := parseMetadataParameter(annotationsParameter, params)
+	if err != nil {
+		return iaas.CreateSnapshotRequest{}, status.Errorf(codes.InvalidArgument, "invalid snapshot annotations: %v", err)
+	}
+	mergeMissing(annotations, classAnnotations)
+
+	mergeMissing(labels, d.CustomLabels)
+	mergeMissing(annotations, d.CustomAnnotations)
+
+	var description string
+	if params[descriptionParameter] != "" {
+		description, err = expandMetadataTemplate(params[descriptionParameter], params)
+		if err != nil {
+			return iaas.CreateSnapshotRequest{}, status.Errorf(codes.InvalidArgument, "invalid snapshot description: %v", err)
+		}
+	}
+
+	var deleteProtection bool
+	if params[deleteProtectionParameter] != "" {
+		deleteProtection, err = strconv.ParseBool(params[deleteProtectionParameter])
+		if err != nil {
+			return iaas.CreateSnapshotRequest{}, status.Errorf(codes.InvalidArgument, "invalid snapshot delete protection %q: %v", params[deleteProtectionParameter], err)
+		}
+	}
+
+	return iaas.CreateSnapshotRequest{
+		Name:             req.GetName(),
+		Description:      description,
+		VolumeIdentity:   volumeIdentity,
+		Labels:           labels,
+		Annotations:      annotations,
+		DeleteProtection: deleteProtection,
+	}, nil
 }
 
 // DeleteSnapshot deletes a snapshot.
@@ -192,6 +260,10 @@ func (d *Driver) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsReques
 	if req.SnapshotId != "" {
 		snapshot, err := d.iaas.GetSnapshot(ctx, req.SnapshotId)
 		if err != nil {
+			if client.IsNotFound(err) {
+				log.Info("snapshot not found")
+				return listResp, nil
+			}
 			return nil, status.Error(codes.Internal, err.Error())
 		}
 		mapped, err := mapToCSISnapshot(snapshot)
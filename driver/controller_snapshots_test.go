@@ -1,10 +1,17 @@
 package driver
 
 import (
+	"context"
+	"log/slog"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/stretchr/testify/require"
 	"github.com/thalassa-cloud/client-go/iaas"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestSnapshotSourceVolumeIdentity(t *testing.T) {
@@ -111,3 +118,171 @@ func TestSnapshotSourceVolumeMatches(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildCreateSnapshotRequest(t *testing.T) {
+	tests := []struct {
+		name                 string
+		params               map[string]string
+		wantDescription      string
+		wantDeleteProtection bool
+		wantLabels           map[string]string
+		wantAnnotations      map[string]string
+		wantErr              error
+	}{
+		{
+			name: "defaults",
+			wantLabels: map[string]string{
+				"csi.volume.id":                       "pvc-1234",
+				"k8s.thalassa.cloud/csi-driver":       "true",
+				"k8s.thalassa.cloud/csi-driver-name":  "csi.k8s.thalassa.cloud",
+				"k8s.thalassa.cloud/cluster-identity": "k8s-1",
+			},
+			wantAnnotations: map[string]string{
+				"csi.snapshot.id":                "snapshot-1234",
+				"k8s.thalassa.cloud/description": "Provisioned by Thalassa CSI driver",
+			},
+		},
+		{
+			name: "snapshot class parameters with snapshot metadata",
+			params: map[string]string{
+				volumeSnapshotNameKey:        "nightly",
+				volumeSnapshotNamespaceKey:   "default",
+				volumeSnapshotContentNameKey: "snapcontent-1234",
+				labelsParameter:              "team=storage,snapshot=${volumesnapshot.name}",
+				annotationsParameter:         "owner=${volumesnapshot.namespace}",
+				descriptionParameter:         "${volumesnapshot.namespace}/${volumesnapshot.name}",
+				deleteProtectionParameter:    "true",
+			},
+			wantDescription:      "default/nightly",
+			wantDeleteProtection: true,
+			wantLabels: map[string]string{
+				"csi.volume.id":                       "pvc-1234",
+				"k8s.thalassa.cloud/csi-driver":       "true",
+				"k8s.thalassa.cloud/csi-driver-name":  "csi.k8s.thalassa.cloud",
+				"k8s.thalassa.cloud/cluster-identity": "k8s-1",
+				volumeSnapshotNameLabel:               "nightly",
+				volumeSnapshotNamespaceLabel:          "default",
+				volumeSnapshotContentNameLabel:        "snapcontent-1234",
+				"team":                                "storage",
+				"snapshot":                            "nightly",
+			},
+			wantAnnotations: map[string]string{
+				"csi.snapshot.id":                "snapshot-1234",
+				"k8s.thalassa.cloud/description": "Provisioned by Thalassa CSI driver",
+				"owner":                          "default",
+			},
+		},
+		{
+			name: "invalid delete protection",
+			params: map[string]string{
+				deleteProtectionParameter: "maybe",
+			},
+			wantErr: status.Error(codes.InvalidArgument, `invalid snapshot delete protection "maybe": strconv.ParseBool: parsing "maybe": invalid syntax`),
+		},
+		{
+			name: "invalid annotations",
+			params: map[string]string{
+				annotationsParameter: "owner",
+			},
+			wantErr: status.Error(codes.InvalidArgument, `invalid snapshot annotations: parameter "annotations": invalid key=value pair "owner"`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Driver{
+				name:            "csi.k8s.thalassa.cloud",
+				clusterIdentity: "k8s-1",
+			}
+			req := &csi.CreateSnapshotRequest{
+				Name:           "snapshot-1234",
+				SourceVolumeId: "pvc-1234",
+				Parameters:     tt.params,
+			}
+
+			got, err := d.buildCreateSnapshotRequest(req, "vol-identity")
+			if tt.wantErr != nil {
+				require.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "snapshot-1234", got.Name)
+			require.Equal(t, "vol-identity", got.VolumeIdentity)
+			require.Equal(t, tt.wantDescription, got.Description)
+			require.Equal(t, tt.wantDeleteProtection, got.DeleteProtection)
+			require.Equal(t, iaas.Labels(tt.wantLabels), got.Labels)
+			require.Equal(t, iaas.Annotations(tt.wantAnnotations), got.Annotations)
+		})
+	}
+}
+
+func TestCreateSnapshot(t *testing.T) {
+	tests := []struct {
+		name         string
+		waitForReady bool
+		status       iaas.SnapshotStatus
+		wantCode     codes.Code
+		wantReady    bool
+	}{
+		{
+			name:   "returns without waiting until the snapshot is ready",
+			status: iaas.SnapshotStatusCreating,
+		},
+		{
+			name:         "waits until the snapshot is ready",
+			waitForReady: true,
+			status:       iaas.SnapshotStatusAvailable,
+			wantReady:    true,
+		},
+		{
+			name:         "snapshot fails while waiting",
+			waitForReady: true,
+			status:       iaas.SnapshotStatusFailed,
+			wantCode:     codes.Internal,
+		},
+		{
+			name:     "snapshot failed without waiting",
+			status:   iaas.SnapshotStatusFailed,
+			wantCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, iaasClient := newFakeAPI(t, map[string]*iaas.Volume{
+				"vol-1": {Identity: "vol-1", Name: "pvc-1", Size: 10},
+			})
+			api.onGetSnapshot = func(snapshot *iaas.Snapshot) {
+				snapshot.Status = tt.status
+			}
+
+			driver := &Driver{
+				name:                 "csi.thalassa.cloud",
+				iaas:                 iaasClient,
+				log:                  slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				waitForSnapshotReady: tt.waitForReady,
+			}
+
+			// a snapshot that is never ready must not block the test
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			resp, err := driver.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{
+				Name:           "snapshot-1",
+				SourceVolumeId: "vol-1",
+			})
+			if tt.wantCode != codes.OK {
+				require.Equal(t, tt.wantCode, status.Code(err), err)
+				require.ErrorContains(t, err, "is in a failed state")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "snap-1", resp.Snapshot.SnapshotId)
+			require.Equal(t, tt.wantReady, resp.Snapshot.ReadyToUse)
+			// the source volume and size are only known after the snapshot
+			// was fetched again
+			require.Equal(t, "vol-1", resp.Snapshot.SourceVolumeId)
+			require.Equal(t, int64(10*giB), resp.Snapshot.SizeBytes)
+		})
+	}
+}
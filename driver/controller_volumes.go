@@ -49,7 +49,7 @@ func validateCreateVolumeAccessibility(req *csi.CreateVolumeRequest, region stri
 	return nil
 }
 
-func createVolumeResponseFromExisting(volume *iaas.Volume, size int64) (*csi.CreateVolumeResponse, error) {
+func createVolumeResponseFromExisting(volume *iaas.Volume, size int64, volumeContext map[string]string) (*csi.CreateVolumeResponse, error) {
 	if int64(volume.Size)*giB != size {
 		return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("invalid option requested size: %d", size))
 	}
@@ -58,10 +58,54 @@ func createVolumeResponseFromExisting(volume *iaas.Volume, size int64) (*csi.Cre
 		Volume: &csi.Volume{
 			VolumeId:      volume.Identity,
 			CapacityBytes: int64(volume.Size) * giB,
+			VolumeContext: volumeContext,
 		},
 	}, nil
 }
 
+// createVolumeContext validates the filesystem parameters and returns the
+// volume context for the node.
+func createVolumeContext(req *csi.CreateVolumeRequest) (map[string]string, error) {
+	volumeContext := mkfsVolumeContext(req.GetParameters())
+	// the PVC is used by the node to record events
+	for _, p := range append(fsckParameters, forceFormatParameter, partitionParameter, pvcNameKey, pvcNamespaceKey) {
+		if v := req.GetParameters()[p]; v != "" {
+			volumeContext[p] = v
+		}
+	}
+	if len(volumeContext) == 0 {
+		return nil, nil
+	}
+
+	_, repair, err := fsckOptions(volumeContext)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid filesystem check parameters: %v", err)
+	}
+	if _, err := forceFormatOption(volumeContext); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid filesystem parameters: %v", err)
+	}
+	if _, err := partitionOption(volumeContext); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid filesystem parameters: %v", err)
+	}
+
+	for _, cap := range req.GetVolumeCapabilities() {
+		if cap.GetMount() == nil {
+			continue
+		}
+		fsType := fsTypeFromCapabilities([]*csi.VolumeCapability{cap}, req.GetParameters())
+		if _, err := mkfsArgsFromParameters(fsType, volumeContext); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid filesystem parameters: %v", err)
+		}
+		if repair {
+			if _, _, err := fsckCommand(fsType, "", true); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid filesystem check parameters: %v", err)
+			}
+		}
+	}
+
+	return volumeContext, nil
+}
+
 func (d *Driver) resolveVolumeTypeIdentity(ctx context.Context, volumeTypeParam string) (string, error) {
 	if volumeTypeParam == "" {
 		volumeTypeParam = "block"
@@ -90,45 +134,97 @@ func (d *Driver) resolveVolumeTypeIdentity(ctx context.Context, volumeTypeParam
 	return volumeTypeIdentity, nil
 }
 
-func (d *Driver) buildCreateVolumeRequest(req *csi.CreateVolumeRequest, volumeName string, size int64, volumeTypeIdentity string) iaas.CreateVolume {
+func (d *Driver) buildCreateVolumeRequest(req *csi.CreateVolumeRequest, volumeName string, size int64, volumeTypeIdentity string) (iaas.CreateVolume, error) {
+	params := req.GetParameters()
+
 	labels := iaas.Labels{
 		"k8s.thalassa.cloud/csi-driver":      "true",
 		"k8s.thalassa.cloud/csi-driver-name": d.name,
+		csiVolumeNameLabel:                   req.Name,
 	}
 	annotations := iaas.Annotations{
 		"k8s.thalassa.cloud/description": "Provisioned by Thalassa CSI driver",
 	}
 
-	if req.Parameters["fstype"] != "" {
-		annotations["k8s.thalassa.cloud/fstype"] = req.Parameters["fstype"]
+	if params["fstype"] != "" {
+		annotations["k8s.thalassa.cloud/fstype"] = params["fstype"]
+	}
+
+	if d.clusterIdentity != "" {
+		labels["k8s.thalassa.cloud/cluster-identity"] = d.clusterIdentity
+	}
+
+	// precedence: driver labels, PVC metadata labels, storage class
+	// parameters and finally the global custom labels and annotations
+	mergeMissing(labels, createMetadataLabels(params))
+
+	scLabels, err := parseMetadataParameter(labelsParameter, params)
+	if err != nil {
+		return iaas.CreateVolume{}, status.Errorf(codes.InvalidArgument, "invalid volume labels: %v", err)
 	}
+	mergeMissing(labels, scLabels)
 
-	for k, v := range d.CustomLabels {
-		if _, ok := labels[k]; !ok {
-			labels[k] = v
+	scAnnotations, err := parseMetadataParameter(annotationsParameter, params)
+	if err != nil {
+		return iaas.CreateVolume{}, status.Errorf(codes.InvalidArgument, "invalid volume annotations: %v", err)
+	}
+	mergeMissing(annotations, scAnnotations)
+
+	mergeMissing(labels, d.CustomLabels)
+	mergeMissing(annotations, d.CustomAnnotations)
+
+	description := createdByThalassaCSI
+	if params[descriptionParameter] != "" {
+		description, err = expandMetadataTemplate(params[descriptionParameter], params)
+		if err != nil {
+			return iaas.CreateVolume{}, status.Errorf(codes.InvalidArgument, "invalid volume description: %v", err)
 		}
 	}
-	for k, v := range d.CustomAnnotations {
-		if _, ok := annotations[k]; !ok {
-			annotations[k] = v
+
+	if params[volumeNameParameter] != "" {
+		volumeName, err = expandMetadataTemplate(params[volumeNameParameter], params)
+		if err != nil {
+			return iaas.CreateVolume{}, status.Errorf(codes.InvalidArgument, "invalid volume name: %v", err)
 		}
 	}
 
-	volumeReq := iaas.CreateVolume{
+	return iaas.CreateVolume{
 		Name:                volumeName,
 		CloudRegionIdentity: d.region,
-		Description:         createdByThalassaCSI,
+		Description:         description,
 		Size:                int(size / giB),
 		VolumeTypeIdentity:  volumeTypeIdentity,
 		Labels:              labels,
 		Annotations:         annotations,
-	}
+	}, nil
+}
 
-	if d.clusterIdentity != "" {
-		volumeReq.Labels["k8s.thalassa.cloud/cluster-identity"] = d.clusterIdentity
+// findVolumeByCSIName looks up a volume by the CSI volume name label. It is
+// used when the volume name in Thalassa differs from the CSI volume name.
+func (d *Driver) findVolumeByCSIName(ctx context.Context, name string) (*iaas.Volume, error) {
+	volumes, err := d.iaas.ListVolumes(ctx, &iaas.ListVolumesRequest{
+		Filters: []filters.Filter{
+			&filters.FilterKeyValue{
+				Key:   filters.FilterRegion,
+				Value: d.region,
+			},
+			&filters.LabelFilter{
+				MatchLabels: map[string]string{
+					csiVolumeNameLabel: name,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return volumeReq
+	for _, vol := range volumes {
+		if vol.Labels[csiVolumeNameLabel] == name {
+			return &vol, nil
+		}
+	}
+	return nil, nil
 }
 
 func (d *Driver) applySnapshotRestore(ctx context.Context, log *slog.Logger, contentSource *csi.VolumeContentSource, volumeReq *iaas.CreateVolume) error {
@@ -143,7 +239,7 @@ func (d *Driver) applySnapshotRestore(ctx context.Context, log *slog.Logger, con
 
 	log.With("snapshot_id", snapshotID).Info("getting snapshot for restore")
 
-	_, err := d.iaas.GetSnapshot(ctx, snapshotID)
+	snapshot, err := d.iaas.GetSnapshot(ctx, snapshotID)
 	if err != nil {
 		if client.IsNotFound(err) {
 			return status.Error(codes.NotFound, "snapshot not found for restore")
@@ -151,12 +247,45 @@ func (d *Driver) applySnapshotRestore(ctx context.Context, log *slog.Logger, con
 		return status.Error(codes.Internal, err.Error())
 	}
 
+	if err := validateSnapshotForRestore(snapshot, d.region, volumeReq.Size); err != nil {
+		return err
+	}
+
+	if snapshot.SizeGB != nil && volumeReq.Size > *snapshot.SizeGB {
+		// the filesystem is expanded by the node when the volume is staged
+		log.With("snapshot_id", snapshotID, "snapshot_size_giga_bytes", *snapshot.SizeGB).Info("restoring snapshot into a larger volume")
+	}
+
 	log.With("snapshot_id", snapshotID).Info("using snapshot to create volume")
 	volumeReq.RestoreFromSnapshotId = &snapshotID
 
 	return nil
 }
 
+// validateSnapshotForRestore checks whether a volume of the given size can be
+// restored from the snapshot in the given region.
+func validateSnapshotForRestore(snapshot *iaas.Snapshot, region string, sizeGigaBytes int) error {
+	if snapshot.Region != nil && !regionMatches(snapshot.Region, region) {
+		return status.Errorf(codes.FailedPrecondition, "snapshot %q is in region %q, volumes can only be restored in region %q", snapshot.Identity, snapshot.Region.Slug, region)
+	}
+
+	if snapshot.Status != iaas.SnapshotStatusAvailable {
+		return status.Errorf(codes.FailedPrecondition, "snapshot %q is not available for restore, status: %q", snapshot.Identity, snapshot.Status)
+	}
+
+	if snapshot.SizeGB != nil && sizeGigaBytes < *snapshot.SizeGB {
+		return status.Errorf(codes.OutOfRange, "requested volume size %dGi is smaller than the size of snapshot %q (%dGi)", sizeGigaBytes, snapshot.Identity, *snapshot.SizeGB)
+	}
+
+	return nil
+}
+
+// regionMatches checks whether the region identity, slug or name matches the
+// configured region.
+func regionMatches(r *iaas.Region, region string) bool {
+	return strings.EqualFold(r.Identity, region) || strings.EqualFold(r.Slug, region) || strings.EqualFold(r.Name, region)
+}
+
 // CreateVolume creates a new volume from the given request
 func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
 	if req.Name == "" {
@@ -171,6 +300,10 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("volume capabilities cannot be satisified: %s", strings.Join(violations, "; ")))
 	}
 
+	if err := validateFsTypes(req.VolumeCapabilities, req.Parameters); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "CreateVolume %v", err)
+	}
+
 	size, err := getStorageSizeFromCapacityRange(req.CapacityRange)
 	if err != nil {
 		return nil, status.Errorf(codes.OutOfRange, "invalid capacity range: %v", err)
@@ -180,6 +313,11 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		return nil, err
 	}
 
+	volumeContext, err := createVolumeContext(req)
+	if err != nil {
+		return nil, err
+	}
+
 	volumeName := req.Name
 
 	volumeIdentity := req.Parameters["volume-identity"]
@@ -198,9 +336,18 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	if volume == nil && req.Parameters[volumeNameParameter] != "" {
+		log.Info("getting volume by CSI volume name label to check if it already exists")
+		volume, err = d.findVolumeByCSIName(ctx, volumeName)
+		if err != nil {
+			log.Error("failed to list volumes to check if it already exists", "error", err)
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
 	if volume != nil {
 		log.With("volume_identity", volume.Identity).Info("volume already created")
-		resp, err := createVolumeResponseFromExisting(volume, size)
+		resp, err := createVolumeResponseFromExisting(volume, size, volumeContext)
 		if err != nil {
 			return nil, err
 		}
@@ -213,7 +360,20 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		return nil, err
 	}
 
-	volumeReq := d.buildCreateVolumeRequest(req, volumeName, size, volumeTypeIdentity)
+	if isMultiNodeCapability(req.VolumeCapabilities...) {
+		volumeType := req.Parameters["volume-type"]
+		if volumeType == "" {
+			volumeType = "block"
+		}
+		if !d.allowsMultiAttach(volumeTypeIdentity, volumeType) {
+			return nil, status.Errorf(codes.InvalidArgument, "volume capabilities cannot be satisified: volume type %q cannot be attached to multiple machines", volumeType)
+		}
+	}
+
+	volumeReq, err := d.buildCreateVolumeRequest(req, volumeName, size, volumeTypeIdentity)
+	if err != nil {
+		return nil, err
+	}
 
 	contentSource := req.GetVolumeContentSource()
 	if err := d.applySnapshotRestore(ctx, log, contentSource, &volumeReq); err != nil {
@@ -238,6 +398,7 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		Volume: &csi.Volume{
 			VolumeId:      vol.Identity,
 			CapacityBytes: size,
+			VolumeContext: volumeContext,
 			AccessibleTopology: []*csi.Topology{
 				{
 					Segments: map[string]string{
@@ -286,22 +447,32 @@ func (d *Driver) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (
 	log := d.log.With("max_entries", req.MaxEntries, "effective_max_entries", maxEntries, "req_starting_token", req.StartingToken, "method", "list_volumes")
 	log.Info("list volumes called")
 
+	// the API does not support pagination, so the driver owned volumes are
+	// listed in full and paginated below
 	volumes, err := d.iaas.ListVolumes(ctx, &iaas.ListVolumesRequest{
 		Filters: []filters.Filter{
 			&filters.FilterKeyValue{
 				Key:   filters.FilterRegion,
 				Value: d.region,
 			},
+			&filters.LabelFilter{
+				MatchLabels: d.ownedVolumeLabels(),
+			},
 		},
 	})
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to list volumes: %s", err)
 	}
 
-	identities := make([]string, len(volumes))
+	identities := make([]string, 0, len(volumes))
 	volumesByIdentity := make(map[string]iaas.Volume, len(volumes))
-	for i, vol := range volumes {
-		identities[i] = vol.Identity
+	for _, vol := range volumes {
+		// inline ephemeral volumes are managed by the node plugin and are
+		// unknown to the CO
+		if !d.isOwnedVolume(&vol) || vol.Labels[ephemeralLabel] == "true" {
+			continue
+		}
+		identities = append(identities, vol.Identity)
 		volumesByIdentity[vol.Identity] = vol
 	}
 
@@ -325,6 +496,7 @@ func (d *Driver) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (
 			},
 			Status: &csi.ListVolumesResponse_VolumeStatus{
 				PublishedNodeIds: attachedMachinesIdentities,
+				VolumeCondition:  volumeCondition(&vol),
 			},
 		})
 	}
@@ -338,6 +510,49 @@ func (d *Driver) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (
 	return resp, nil
 }
 
+// ownedVolumeLabels returns the labels of the volumes provisioned by this
+// driver for this cluster.
+func (d *Driver) ownedVolumeLabels() map[string]string {
+	labels := map[string]string{
+		"k8s.thalassa.cloud/csi-driver-name": d.name,
+	}
+	if d.clusterIdentity != "" {
+		labels["k8s.thalassa.cloud/cluster-identity"] = d.clusterIdentity
+	}
+	return labels
+}
+
+// isOwnedVolume checks whether the volume was provisioned by this driver for
+// this cluster.
+func (d *Driver) isOwnedVolume(vol *iaas.Volume) bool {
+	for k, v := range d.ownedVolumeLabels() {
+		if vol.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// volumeStatusFailed is the status of a volume that failed. The client does
+// not define the statuses of volumes and only waits for "available",
+// "attached", "deleting" and "deleted"; "failed" is the failure status of
+// the resources with the same lifecycle, such as iaas.ReservedIpStatusFailed.
+const volumeStatusFailed = "failed"
+
+// volumeCondition maps the status of the volume to a CSI volume condition.
+func volumeCondition(vol *iaas.Volume) *csi.VolumeCondition {
+	if strings.EqualFold(vol.Status, volumeStatusFailed) {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("volume %q is in status %q", vol.Identity, vol.Status),
+		}
+	}
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  fmt.Sprintf("volume %q is %s", vol.Identity, strings.ToLower(vol.Status)),
+	}
+}
+
 // ControllerGetVolume gets a specific volume.
 // The call is used for the CSI health check feature
 // (https://github.com/kubernetes/enhancements/pull/1077) which we do not
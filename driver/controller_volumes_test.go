@@ -0,0 +1,242 @@
+package driver
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+	"github.com/thalassa-cloud/client-go/iaas"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateSnapshotForRestore(t *testing.T) {
+	sizeGB := 10
+	region := &iaas.Region{Identity: "region-identity", Slug: "nl-01", Name: "NL-01"}
+
+	tests := []struct {
+		name          string
+		snapshot      iaas.Snapshot
+		sizeGigaBytes int
+		wantErr       error
+	}{
+		{
+			name: "same size",
+			snapshot: iaas.Snapshot{
+				Identity: "snap-1",
+				Region:   region,
+				Status:   iaas.SnapshotStatusAvailable,
+				SizeGB:   &sizeGB,
+			},
+			sizeGigaBytes: 10,
+		},
+		{
+			name: "larger volume than snapshot",
+			snapshot: iaas.Snapshot{
+				Identity: "snap-1",
+				Region:   region,
+				Status:   iaas.SnapshotStatusAvailable,
+				SizeGB:   &sizeGB,
+			},
+			sizeGigaBytes: 20,
+		},
+		{
+			name: "unknown region and size",
+			snapshot: iaas.Snapshot{
+				Identity: "snap-1",
+				Status:   iaas.SnapshotStatusAvailable,
+			},
+			sizeGigaBytes: 1,
+		},
+		{
+			name: "smaller volume than snapshot",
+			snapshot: iaas.Snapshot{
+				Identity: "snap-1",
+				Region:   region,
+				Status:   iaas.SnapshotStatusAvailable,
+				SizeGB:   &sizeGB,
+			},
+			sizeGigaBytes: 5,
+			wantErr:       status.Error(codes.OutOfRange, `requested volume size 5Gi is smaller than the size of snapshot "snap-1" (10Gi)`),
+		},
+		{
+			name: "snapshot in another region",
+			snapshot: iaas.Snapshot{
+				Identity: "snap-1",
+				Region:   &iaas.Region{Identity: "other-identity", Slug: "de-01"},
+				Status:   iaas.SnapshotStatusAvailable,
+				SizeGB:   &sizeGB,
+			},
+			sizeGigaBytes: 10,
+			wantErr:       status.Error(codes.FailedPrecondition, `snapshot "snap-1" is in region "de-01", volumes can only be restored in region "nl-01"`),
+		},
+		{
+			name: "snapshot still being created",
+			snapshot: iaas.Snapshot{
+				Identity: "snap-1",
+				Region:   region,
+				Status:   iaas.SnapshotStatusCreating,
+			},
+			sizeGigaBytes: 10,
+			wantErr:       status.Error(codes.FailedPrecondition, `snapshot "snap-1" is not available for restore, status: "Creating"`),
+		},
+		{
+			name: "failed snapshot",
+			snapshot: iaas.Snapshot{
+				Identity: "snap-1",
+				Region:   region,
+				Status:   iaas.SnapshotStatusFailed,
+			},
+			sizeGigaBytes: 10,
+			wantErr:       status.Error(codes.FailedPrecondition, `snapshot "snap-1" is not available for restore, status: "Failed"`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSnapshotForRestore(&tt.snapshot, "nl-01", tt.sizeGigaBytes)
+			if tt.wantErr != nil {
+				require.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestIsOwnedVolume(t *testing.T) {
+	tests := []struct {
+		name            string
+		clusterIdentity string
+		labels          iaas.Labels
+		want            bool
+	}{
+		{
+			name:            "owned by driver and cluster",
+			clusterIdentity: "k8s-1",
+			labels: iaas.Labels{
+				"k8s.thalassa.cloud/csi-driver-name":  "csi.k8s.thalassa.cloud",
+				"k8s.thalassa.cloud/cluster-identity": "k8s-1",
+			},
+			want: true,
+		},
+		{
+			name: "owned by driver without cluster identity",
+			labels: iaas.Labels{
+				"k8s.thalassa.cloud/csi-driver-name":  "csi.k8s.thalassa.cloud",
+				"k8s.thalassa.cloud/cluster-identity": "k8s-2",
+			},
+			want: true,
+		},
+		{
+			name:            "owned by another cluster",
+			clusterIdentity: "k8s-1",
+			labels: iaas.Labels{
+				"k8s.thalassa.cloud/csi-driver-name":  "csi.k8s.thalassa.cloud",
+				"k8s.thalassa.cloud/cluster-identity": "k8s-2",
+			},
+			want: false,
+		},
+		{
+			name:   "not created by the driver",
+			labels: iaas.Labels{},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Driver{
+				name:            "csi.k8s.thalassa.cloud",
+				clusterIdentity: tt.clusterIdentity,
+			}
+			require.Equal(t, tt.want, d.isOwnedVolume(&iaas.Volume{Labels: tt.labels}))
+		})
+	}
+}
+
+func TestVolumeCondition(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       string
+		wantAbnormal bool
+		wantMessage  string
+	}{
+		{
+			name:        "available",
+			status:      "available",
+			wantMessage: `volume "vol-1" is available`,
+		},
+		{
+			name:        "attached",
+			status:      "Attached",
+			wantMessage: `volume "vol-1" is attached`,
+		},
+		{
+			name:         "failed",
+			status:       "Failed",
+			wantAbnormal: true,
+			wantMessage:  `volume "vol-1" is in status "Failed"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := volumeCondition(&iaas.Volume{Identity: "vol-1", Status: tt.status})
+			require.Equal(t, tt.wantAbnormal, got.Abnormal)
+			require.Equal(t, tt.wantMessage, got.Message)
+		})
+	}
+}
+
+func TestListVolumes(t *testing.T) {
+	volume := func(identity, status string, labels iaas.Labels) *iaas.Volume {
+		return &iaas.Volume{Identity: identity, Status: status, Size: 10, Labels: labels}
+	}
+	owned := iaas.Labels{
+		"k8s.thalassa.cloud/csi-driver-name":  "csi.k8s.thalassa.cloud",
+		"k8s.thalassa.cloud/cluster-identity": "k8s-1",
+	}
+	ephemeral := iaas.Labels{ephemeralLabel: "true", ephemeralNodeLabel: "node-1"}
+	for k, v := range owned {
+		ephemeral[k] = v
+	}
+
+	attached := volume("vol-1", "attached", owned)
+	attached.Attachments = []iaas.VolumeAttachment{{AttachedToIdentity: "vm-1"}}
+	_, iaasClient := newFakeAPI(t, map[string]*iaas.Volume{
+		"vol-1": attached,
+		"vol-2": volume("vol-2", "failed", owned),
+		"vol-3": volume("vol-3", "available", iaas.Labels{}),
+		"vol-4": volume("vol-4", "available", iaas.Labels{
+			"k8s.thalassa.cloud/csi-driver-name":  "csi.k8s.thalassa.cloud",
+			"k8s.thalassa.cloud/cluster-identity": "k8s-2",
+		}),
+		"vol-5": volume("vol-5", "attached", ephemeral),
+	})
+
+	driver := &Driver{
+		name:            "csi.k8s.thalassa.cloud",
+		clusterIdentity: "k8s-1",
+		iaas:            iaasClient,
+		log:             slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	}
+
+	resp, err := driver.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+	require.NoError(t, err)
+	require.Empty(t, resp.NextToken)
+	require.Len(t, resp.Entries, 2)
+
+	require.Equal(t, "vol-1", resp.Entries[0].Volume.VolumeId)
+	require.Equal(t, int64(10*giB), resp.Entries[0].Volume.CapacityBytes)
+	require.Equal(t, []string{"vm-1"}, resp.Entries[0].Status.PublishedNodeIds)
+	require.False(t, resp.Entries[0].Status.VolumeCondition.Abnormal)
+	require.Equal(t, `volume "vol-1" is attached`, resp.Entries[0].Status.VolumeCondition.Message)
+
+	require.Equal(t, "vol-2", resp.Entries[1].Volume.VolumeId)
+	require.True(t, resp.Entries[1].Status.VolumeCondition.Abnormal)
+	require.Equal(t, `volume "vol-2" is in status "failed"`, resp.Entries[1].Status.VolumeCondition.Message)
+}
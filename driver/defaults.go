@@ -50,11 +50,24 @@ const (
 )
 
 var (
-	// Thalassa Cloud currently only support a single node to be attached to a single node
-	// in read/write mode. This corresponds to `accessModes.ReadWriteOnce` in a
-	// PVC resource on Kubernetes
-	supportedAccessMode = &csi.VolumeCapability_AccessMode{
-		Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+	// Thalassa Cloud volumes are attached read/write to a single machine.
+	// This corresponds to `accessModes.ReadWriteOnce` and, with the single
+	// writer mode, `accessModes.ReadWriteOncePod` in a PVC resource on
+	// Kubernetes
+	supportedAccessModes = []csi.VolumeCapability_AccessMode_Mode{
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER,
+	}
+
+	// readOnlyAccessModes are supported for volumes that are published read
+	// only. MULTI_NODE_READER_ONLY is only supported for the volume types
+	// that can be attached to multiple machines, see multiAttachVolumeTypes.
+	// They correspond to `accessModes.ReadOnlyMany` in a PVC resource on
+	// Kubernetes.
+	readOnlyAccessModes = []csi.VolumeCapability_AccessMode_Mode{
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
 	}
 )
 
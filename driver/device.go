@@ -0,0 +1,391 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	sysBlockPath = "/sys/block"
+
+	// virtioSerialLength is the maximum length of a virtio-blk serial, longer
+	// serials are truncated by the hypervisor
+	virtioSerialLength = 20
+
+	// defaultDeviceWaitTimeout and defaultDeviceWaitInterval define how long
+	// to wait for udev to create the device of an attached volume
+	defaultDeviceWaitTimeout  = 30 * time.Second
+	defaultDeviceWaitInterval = time.Second
+
+	// buses a volume can be attached on
+	busSCSI   = "scsi"
+	busVirtio = "virtio"
+	busNVMe   = "nvme"
+)
+
+// deviceHints identify the device of an attached volume. They are passed by
+// the controller in the publish context.
+type deviceHints struct {
+	// Serial is the serial of the volume attachment
+	Serial string
+	// AttachmentID is the identity of the volume attachment
+	AttachmentID string
+	// Bus is the bus the volume is expected to be attached on
+	Bus string
+}
+
+// deviceManager finds the devices of attached volumes.
+type deviceManager struct {
+	log *slog.Logger
+
+	byIDPath     string
+	sysBlockPath string
+	devPath      string
+
+	timeout  time.Duration
+	interval time.Duration
+
+	// triggerUdev asks udev to process the block devices again, and waits
+	// for it until the context is done
+	triggerUdev func(ctx context.Context) error
+	// growPartition grows a partition of a disk to the end of the disk
+	growPartition func(disk string, partition int) error
+}
+
+// newDeviceManager returns a device manager for the devices of the host.
+func newDeviceManager(log *slog.Logger, timeout, interval time.Duration) *deviceManager {
+	if timeout <= 0 {
+		timeout = defaultDeviceWaitTimeout
+	}
+	if interval <= 0 {
+		interval = defaultDeviceWaitInterval
+	}
+	return &deviceManager{
+		log:           log,
+		byIDPath:      diskIDPath,
+		sysBlockPath:  sysBlockPath,
+		devPath:       "/dev",
+		timeout:       timeout,
+		interval:      interval,
+		triggerUdev:   udevadmTrigger,
+		growPartition: growpart,
+	}
+}
+
+// udevadmTrigger replays the add events of the block devices, so udev
+// creates the missing /dev/disk/by-id links. udevadm settle waits at most
+// until the deadline of the context.
+func udevadmTrigger(ctx context.Context) error {
+	udevadmCmd := "udevadm"
+	if _, err := exec.LookPath(udevadmCmd); err != nil {
+		return fmt.Errorf("%q executable not found in $PATH", udevadmCmd)
+	}
+
+	args := []string{"trigger", "--action=add", "--subsystem-match=block"}
+	out, err := exec.CommandContext(ctx, udevadmCmd, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("triggering udev failed: %v cmd: '%s %s' output: %q",
+			err, udevadmCmd, strings.Join(args, " "), string(out))
+	}
+
+	args = []string{"settle"}
+	if deadline, ok := ctx.Deadline(); ok {
+		// the default timeout of 120 seconds may exceed the deadline
+		args = append(args, fmt.Sprintf("--timeout=%d", settleTimeout(time.Until(deadline))))
+	}
+	out, err = exec.CommandContext(ctx, udevadmCmd, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("waiting for udev failed: %v cmd: '%s %s' output: %q",
+			err, udevadmCmd, strings.Join(args, " "), string(out))
+	}
+	return nil
+}
+
+// settleTimeout returns the remaining time in whole seconds for udevadm
+// settle, at least one second as a timeout of 0 does not wait at all.
+func settleTimeout(remaining time.Duration) int {
+	seconds := int((remaining + time.Second - 1) / time.Second)
+	return max(seconds, 1)
+}
+
+// deviceIdentifiers returns the identifiers the device of the volume can be
+// known by: the attachment serial, the volume ID, and their virtio truncated
+// forms.
+func deviceIdentifiers(volumeID string, hints deviceHints) []string {
+	var ids []string
+	add := func(id string) {
+		if id == "" {
+			return
+		}
+		for _, existing := range ids {
+			if existing == id {
+				return
+			}
+		}
+		ids = append(ids, id)
+	}
+
+	for _, id := range []string{hints.Serial, volumeID} {
+		add(id)
+	}
+	for _, id := range []string{hints.Serial, volumeID} {
+		if len(id) > virtioSerialLength {
+			add(id[:virtioSerialLength])
+		}
+	}
+	return ids
+}
+
+// byIDCandidates returns the /dev/disk/by-id patterns the device of the
+// volume may be linked as, for SCSI, virtio-blk and NVMe disks. The patterns
+// of the expected bus are tried first.
+func (dm *deviceManager) byIDCandidates(ids []string, bus string) []string {
+	patterns := map[string][]string{
+		busSCSI:   {diskByIdPrefix + "%s", "scsi-SQEMU_QEMU_HARDDISK_%s"},
+		busVirtio: {"virtio-%s"},
+		busNVMe:   {"nvme-*_%s"},
+	}
+
+	buses := []string{busSCSI, busVirtio, busNVMe}
+	if _, ok := patterns[bus]; ok {
+		buses = append([]string{bus}, slices.DeleteFunc(buses, func(b string) bool { return b == bus })...)
+	}
+
+	var candidates []string
+	for _, b := range buses {
+		for _, pattern := range patterns[b] {
+			for _, id := range ids {
+				candidates = append(candidates, filepath.Join(dm.byIDPath, fmt.Sprintf(pattern, id)))
+			}
+		}
+	}
+	return candidates
+}
+
+// findByID returns the first /dev/disk/by-id link that exists for the
+// identifiers.
+func (dm *deviceManager) findByID(ids []string, bus string) (string, bool) {
+	for _, candidate := range dm.byIDCandidates(ids, bus) {
+		matches, err := filepath.Glob(candidate)
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			// skip dangling links of detached devices
+			if _, err := os.Stat(match); err == nil {
+				return match, true
+			}
+		}
+	}
+	return "", false
+}
+
+// serialCandidates returns the sysfs patterns of the serials of the block
+// devices. virtio-blk devices expose the serial in /sys/block/<dev>/serial
+// and NVMe devices in /sys/block/<dev>/device/serial.
+func (dm *deviceManager) serialCandidates() []string {
+	return []string{
+		filepath.Join(dm.sysBlockPath, "*", "serial"),
+		filepath.Join(dm.sysBlockPath, "*", "device", "serial"),
+	}
+}
+
+// findBySerial scans the serials the kernel exposes for the block devices,
+// which works without udev.
+func (dm *deviceManager) findBySerial(ids []string) (string, bool) {
+	for _, pattern := range dm.serialCandidates() {
+		serialFiles, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, serialFile := range serialFiles {
+			content, err := os.ReadFile(serialFile)
+			if err != nil {
+				continue
+			}
+			serial := strings.TrimSpace(string(content))
+			for _, id := range ids {
+				if serial != id {
+					continue
+				}
+				rel, err := filepath.Rel(dm.sysBlockPath, serialFile)
+				if err != nil {
+					continue
+				}
+				name := strings.Split(rel, string(filepath.Separator))[0]
+				return filepath.Join(dm.devPath, name), true
+			}
+		}
+	}
+	return "", false
+}
+
+// findDevice looks up the device once, preferring the stable by-id links.
+func (dm *deviceManager) findDevice(ids []string, bus string) (string, bool) {
+	if device, ok := dm.findByID(ids, bus); ok {
+		return device, true
+	}
+	return dm.findBySerial(ids)
+}
+
+// GetDeviceByID returns the device path of the attached volume. It waits for
+// udev to create the device, and asks udev to process the block devices again
+// when the device is not there yet. The by-id directory is watched with
+// inotify where available, so the device is found as soon as it appears,
+// and polled at the configured interval otherwise. Waiting stops when the
+// context is done.
+func (dm *deviceManager) GetDeviceByID(ctx context.Context, volumeID string, hints deviceHints) (string, error) {
+	ids := deviceIdentifiers(volumeID, hints)
+	log := dm.log.With("volume_id", volumeID, "serial", hints.Serial, "attachment_id", hints.AttachmentID, "bus", hints.Bus)
+
+	if device, ok := dm.findDevice(ids, hints.Bus); ok {
+		log.Info("found device of the volume", "device_path", device)
+		return device, nil
+	}
+
+	var events <-chan fsnotify.Event
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer watcher.Close()
+		if err := watcher.Add(dm.byIDPath); err == nil {
+			events = watcher.Events
+		} else {
+			log.Info("unable to watch for new devices, polling instead", "path", dm.byIDPath, "error", err)
+		}
+	} else {
+		log.Info("unable to watch for new devices, polling instead", "error", err)
+	}
+
+	log.Info("waiting for the device of the volume", "timeout", dm.timeout, "interval", dm.interval)
+	waitCtx, cancel := context.WithTimeout(ctx, dm.timeout)
+	defer cancel()
+	ticker := time.NewTicker(dm.interval)
+	defer ticker.Stop()
+
+	// udev may have missed the event of a hot plugged disk
+	if dm.triggerUdev != nil {
+		log.Info("device of the volume not found, triggering udev")
+		if err := dm.triggerUdev(waitCtx); err != nil {
+			log.Warn("failed to trigger udev", "error", err)
+		}
+	}
+
+	for {
+		if device, ok := dm.findDevice(ids, hints.Bus); ok {
+			log.Info("found device of the volume", "device_path", device)
+			return device, nil
+		}
+
+		select {
+		case <-waitCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return "", fmt.Errorf("stopped waiting for the device of volume %q: %w", volumeID, err)
+			}
+			checked := append(dm.byIDCandidates(ids, hints.Bus), dm.serialCandidates()...)
+			return "", fmt.Errorf("%w: device of volume %q did not appear within %s, checked %s",
+				ErrDeviceNotFound, volumeID, dm.timeout, strings.Join(checked, ", "))
+		case <-events:
+		case <-ticker.C:
+		}
+	}
+}
+
+// IsDeviceAttached checks whether the device exists and, for devices that
+// report it, whether the device is running.
+func (dm *deviceManager) IsDeviceAttached(devicePath string) error {
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDeviceNotAttached, err)
+	}
+
+	name := filepath.Base(resolved)
+	state, err := os.ReadFile(filepath.Join(dm.sysBlockPath, name, "device", "state"))
+	if err != nil {
+		// not all devices report their state, e.g. virtio-blk
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// SCSI devices report running, NVMe controllers live
+	switch s := strings.TrimSpace(string(state)); s {
+	case runningState, "live":
+		return nil
+	default:
+		return fmt.Errorf("%w: device %q is in state %q", ErrDeviceNotAttached, resolved, s)
+	}
+}
+
+// deviceSerial returns the serial the kernel reports for the device, or an
+// empty string when it does not report one.
+func (dm *deviceManager) deviceSerial(devicePath string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(resolved)
+
+	for _, serialFile := range []string{"serial", "device/serial"} {
+		content, err := os.ReadFile(filepath.Join(dm.sysBlockPath, name, serialFile))
+		if err == nil {
+			return strings.TrimSpace(string(content)), nil
+		}
+	}
+
+	// SCSI disks report the serial in the unit serial number VPD page, which
+	// starts with a 4 byte header
+	content, err := os.ReadFile(filepath.Join(dm.sysBlockPath, name, "device", "vpd_pg80"))
+	if err == nil && len(content) > 4 {
+		return strings.TrimSpace(string(content[4:])), nil
+	}
+	return "", nil
+}
+
+// VerifyDeviceSerial checks whether the serial of the device matches the
+// serial of the volume attachment. Devices that do not report a serial and
+// volumes without a known attachment serial are not rejected.
+func (dm *deviceManager) VerifyDeviceSerial(devicePath string, hints deviceHints) error {
+	if hints.Serial == "" {
+		return nil
+	}
+
+	serial, err := dm.deviceSerial(devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to read serial of device %q: %v", devicePath, err)
+	}
+	if serial == "" {
+		dm.log.Info("device does not report a serial, skipping the serial check", "device_path", devicePath)
+		return nil
+	}
+
+	if slices.Contains(deviceIdentifiers("", hints), serial) {
+		return nil
+	}
+	return fmt.Errorf("%w: device %q has serial %q, expected %q", ErrDeviceSerialMismatch, devicePath, serial, hints.Serial)
+}
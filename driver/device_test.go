@@ -0,0 +1,292 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testDeviceManager returns a device manager for a fake /dev and /sys/block
+// in a temporary directory.
+func testDeviceManager(t *testing.T) *deviceManager {
+	t.Helper()
+
+	root := t.TempDir()
+	dm := &deviceManager{
+		log:          slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		byIDPath:     filepath.Join(root, "dev", "disk", "by-id"),
+		sysBlockPath: filepath.Join(root, "sys", "block"),
+		devPath:      filepath.Join(root, "dev"),
+		interval:     time.Millisecond,
+	}
+	require.NoError(t, os.MkdirAll(dm.byIDPath, 0755))
+	require.NoError(t, os.MkdirAll(dm.sysBlockPath, 0755))
+	return dm
+}
+
+// addDevice creates a fake device node and, when set, a by-id link to it
+// and its serial in sysfs.
+func addDevice(t *testing.T, dm *deviceManager, name, byID, serialFile, serial string) string {
+	t.Helper()
+
+	device := filepath.Join(dm.devPath, name)
+	require.NoError(t, os.WriteFile(device, nil, 0600))
+	if byID != "" {
+		require.NoError(t, os.Symlink(device, filepath.Join(dm.byIDPath, byID)))
+	}
+	if serialFile != "" {
+		path := filepath.Join(dm.sysBlockPath, name, serialFile)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(serial+"\n"), 0644))
+	}
+	return device
+}
+
+func TestDeviceIdentifiers(t *testing.T) {
+	require.Equal(t, []string{"vol-1"}, deviceIdentifiers("vol-1", deviceHints{}))
+	require.Equal(t, []string{"serial-1", "vol-1"}, deviceIdentifiers("vol-1", deviceHints{Serial: "serial-1"}))
+	require.Equal(t,
+		[]string{"vol-0123456789abcdefghij-long", "vol-0123456789abcdef"},
+		deviceIdentifiers("vol-0123456789abcdefghij-long", deviceHints{}))
+}
+
+func TestDeviceManagerGetDeviceByID(t *testing.T) {
+	longID := "vol-0123456789abcdefghij"
+
+	tests := []struct {
+		name     string
+		volumeID string
+		hints    deviceHints
+		setup    func(t *testing.T, dm *deviceManager) string
+	}{
+		{
+			name:     "QEMU SCSI disk",
+			volumeID: "vol-1",
+			setup: func(t *testing.T, dm *deviceManager) string {
+				addDevice(t, dm, "sdb", "scsi-0QEMU_QEMU_HARDDISK_vol-1", "", "")
+				return filepath.Join(dm.byIDPath, "scsi-0QEMU_QEMU_HARDDISK_vol-1")
+			},
+		},
+		{
+			name:     "virtio disk with truncated serial",
+			volumeID: longID,
+			setup: func(t *testing.T, dm *deviceManager) string {
+				addDevice(t, dm, "vdb", "virtio-"+longID[:virtioSerialLength], "", "")
+				return filepath.Join(dm.byIDPath, "virtio-"+longID[:virtioSerialLength])
+			},
+		},
+		{
+			name:     "NVMe disk matched by attachment serial",
+			volumeID: "vol-1",
+			hints:    deviceHints{Serial: "serial-1"},
+			setup: func(t *testing.T, dm *deviceManager) string {
+				addDevice(t, dm, "nvme1n1", "nvme-QEMU_NVMe_Ctrl_serial-1", "", "")
+				return filepath.Join(dm.byIDPath, "nvme-QEMU_NVMe_Ctrl_serial-1")
+			},
+		},
+		{
+			name:     "virtio disk without udev link",
+			volumeID: "vol-1",
+			setup: func(t *testing.T, dm *deviceManager) string {
+				addDevice(t, dm, "vda", "", "serial", "root-disk")
+				return addDevice(t, dm, "vdb", "", "serial", "vol-1")
+			},
+		},
+		{
+			name:     "NVMe disk without udev link",
+			volumeID: "vol-1",
+			hints:    deviceHints{Serial: "serial-1"},
+			setup: func(t *testing.T, dm *deviceManager) string {
+				return addDevice(t, dm, "nvme1n1", "", "device/serial", "serial-1")
+			},
+		},
+		{
+			name:     "dangling link of a detached disk",
+			volumeID: "vol-1",
+			setup: func(t *testing.T, dm *deviceManager) string {
+				require.NoError(t, os.Symlink(filepath.Join(dm.devPath, "sdc"), filepath.Join(dm.byIDPath, "scsi-0QEMU_QEMU_HARDDISK_vol-1")))
+				addDevice(t, dm, "vdb", "virtio-vol-1", "", "")
+				return filepath.Join(dm.byIDPath, "virtio-vol-1")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm := testDeviceManager(t)
+			want := tt.setup(t, dm)
+
+			got, err := dm.GetDeviceByID(context.Background(), tt.volumeID, tt.hints)
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestDeviceManagerGetDeviceByIDWaitsForUdev(t *testing.T) {
+	dm := testDeviceManager(t)
+	dm.timeout = 5 * time.Second
+
+	triggered := 0
+	dm.triggerUdev = func(ctx context.Context) error {
+		triggered++
+		addDevice(t, dm, "sdb", "scsi-0QEMU_QEMU_HARDDISK_vol-1", "", "")
+		return nil
+	}
+
+	got, err := dm.GetDeviceByID(context.Background(), "vol-1", deviceHints{})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dm.byIDPath, "scsi-0QEMU_QEMU_HARDDISK_vol-1"), got)
+	require.Equal(t, 1, triggered)
+}
+
+func TestDeviceManagerGetDeviceByIDTimeout(t *testing.T) {
+	dm := testDeviceManager(t)
+	dm.timeout = 10 * time.Millisecond
+	dm.triggerUdev = func(ctx context.Context) error {
+		return errors.New("udevadm not available")
+	}
+
+	_, err := dm.GetDeviceByID(context.Background(), "vol-1", deviceHints{})
+	require.ErrorIs(t, err, ErrDeviceNotFound)
+	require.ErrorContains(t, err, filepath.Join(dm.byIDPath, "scsi-0QEMU_QEMU_HARDDISK_vol-1"))
+	require.ErrorContains(t, err, filepath.Join(dm.sysBlockPath, "*", "serial"))
+}
+
+func TestDeviceManagerGetDeviceByIDCancelled(t *testing.T) {
+	dm := testDeviceManager(t)
+	dm.timeout = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dm.triggerUdev = func(ctx context.Context) error {
+		// udevadm settle must not wait longer than the device
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		require.WithinDuration(t, time.Now().Add(dm.timeout), deadline, time.Second)
+		cancel()
+		return nil
+	}
+
+	start := time.Now()
+	_, err := dm.GetDeviceByID(ctx, "vol-1", deviceHints{})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), dm.timeout)
+}
+
+func TestSettleTimeout(t *testing.T) {
+	require.Equal(t, 30, settleTimeout(30*time.Second))
+	require.Equal(t, 2, settleTimeout(1500*time.Millisecond))
+	require.Equal(t, 1, settleTimeout(0))
+	require.Equal(t, 1, settleTimeout(-time.Second))
+}
+
+func TestDeviceManagerGetDeviceByIDWatchesByID(t *testing.T) {
+	dm := testDeviceManager(t)
+	dm.timeout = 5 * time.Second
+	// the device is found through inotify long before the next poll
+	dm.interval = time.Minute
+
+	device := filepath.Join(dm.devPath, "sdb")
+	require.NoError(t, os.WriteFile(device, nil, 0600))
+	linked := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		linked <- os.Symlink(device, filepath.Join(dm.byIDPath, "scsi-0QEMU_QEMU_HARDDISK_vol-1"))
+	}()
+
+	start := time.Now()
+	got, err := dm.GetDeviceByID(context.Background(), "vol-1", deviceHints{})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dm.byIDPath, "scsi-0QEMU_QEMU_HARDDISK_vol-1"), got)
+	require.Less(t, time.Since(start), dm.timeout)
+	require.NoError(t, <-linked)
+}
+
+func TestDeviceManagerGetDeviceByIDPrefersBus(t *testing.T) {
+	dm := testDeviceManager(t)
+	addDevice(t, dm, "sdb", "scsi-0QEMU_QEMU_HARDDISK_vol-1", "", "")
+	addDevice(t, dm, "vdb", "virtio-vol-1", "", "")
+
+	got, err := dm.GetDeviceByID(context.Background(), "vol-1", deviceHints{})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dm.byIDPath, "scsi-0QEMU_QEMU_HARDDISK_vol-1"), got)
+
+	got, err = dm.GetDeviceByID(context.Background(), "vol-1", deviceHints{Bus: busVirtio})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dm.byIDPath, "virtio-vol-1"), got)
+}
+
+func TestDeviceManagerVerifyDeviceSerial(t *testing.T) {
+	longSerial := "serial-0123456789abcdefghij"
+
+	tests := []struct {
+		name    string
+		hints   deviceHints
+		setup   func(t *testing.T, dm *deviceManager) string
+		wantErr bool
+	}{
+		{
+			name:  "matching serial",
+			hints: deviceHints{Serial: "serial-1"},
+			setup: func(t *testing.T, dm *deviceManager) string {
+				return addDevice(t, dm, "vdb", "", "serial", "serial-1")
+			},
+		},
+		{
+			name:  "serial truncated by virtio",
+			hints: deviceHints{Serial: longSerial},
+			setup: func(t *testing.T, dm *deviceManager) string {
+				return addDevice(t, dm, "vdb", "", "serial", longSerial[:virtioSerialLength])
+			},
+		},
+		{
+			name:  "SCSI unit serial number page",
+			hints: deviceHints{Serial: "serial-1"},
+			setup: func(t *testing.T, dm *deviceManager) string {
+				return addDevice(t, dm, "sdb", "", "device/vpd_pg80", "\x00\x80\x00\x08serial-1")
+			},
+		},
+		{
+			name:  "device without serial",
+			hints: deviceHints{Serial: "serial-1"},
+			setup: func(t *testing.T, dm *deviceManager) string {
+				return addDevice(t, dm, "sdb", "", "", "")
+			},
+		},
+		{
+			name: "attachment without serial",
+			setup: func(t *testing.T, dm *deviceManager) string {
+				return addDevice(t, dm, "vdb", "", "serial", "serial-2")
+			},
+		},
+		{
+			name:  "serial of another volume",
+			hints: deviceHints{Serial: "serial-1"},
+			setup: func(t *testing.T, dm *deviceManager) string {
+				addDevice(t, dm, "vdb", "virtio-serial-1", "serial", "serial-2")
+				return filepath.Join(dm.byIDPath, "virtio-serial-1")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm := testDeviceManager(t)
+			devicePath := tt.setup(t, dm)
+
+			err := dm.VerifyDeviceSerial(devicePath, tt.hints)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrDeviceSerialMismatch)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,337 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/thalassa-cloud/client-go/filters"
+	"github.com/thalassa-cloud/client-go/iaas"
+	"github.com/thalassa-cloud/client-go/pkg/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// ephemeralContextKey is set to true in the volume context of CSI inline
+	// ephemeral volumes, which are created and deleted by the node plugin
+	ephemeralContextKey = "csi.storage.k8s.io/ephemeral"
+
+	// ephemeralSizeAttribute and ephemeralTypeAttribute are the volume
+	// attributes of an inline ephemeral volume in the pod spec
+	ephemeralSizeAttribute = "size"
+	ephemeralTypeAttribute = "type"
+
+	// ephemeralLabel and ephemeralNodeLabel mark the volumes created for
+	// inline ephemeral volumes and the node that created them
+	ephemeralLabel     = "k8s.thalassa.cloud/ephemeral"
+	ephemeralNodeLabel = "k8s.thalassa.cloud/ephemeral-node"
+	// ephemeralTargetPathAnnotation records where the volume is mounted, so
+	// the sweeper can tell whether it is still in use
+	ephemeralTargetPathAnnotation = "k8s.thalassa.cloud/ephemeral-target-path"
+
+	// ephemeralVolumeHandlePrefix is the prefix of the volume handles the
+	// kubelet generates for inline ephemeral volumes
+	ephemeralVolumeHandlePrefix = "csi-"
+
+	// ephemeralSweepGracePeriod is how long a new ephemeral volume is left
+	// alone by the sweeper, as it may still be being published
+	ephemeralSweepGracePeriod = 15 * time.Minute
+
+	defaultEphemeralSweepInterval = 10 * time.Minute
+)
+
+// isEphemeralVolume returns whether the volume context is the one of an
+// inline ephemeral volume.
+func isEphemeralVolume(volumeContext map[string]string) bool {
+	return volumeContext[ephemeralContextKey] == "true"
+}
+
+// ephemeralVolumesEnabled returns whether the node plugin creates inline
+// ephemeral volumes, which requires an API client and allowed volume types.
+func (d *Driver) ephemeralVolumesEnabled() bool {
+	return d.iaas != nil && len(d.ephemeralVolumeTypes) > 0
+}
+
+// ephemeralVolumeOptions returns the size in bytes and the volume type of an
+// inline ephemeral volume from its volume attributes. The size is rounded up
+// to whole GiB, and both are checked against the allowlist of the node.
+func (d *Driver) ephemeralVolumeOptions(volumeContext map[string]string) (int64, string, error) {
+	size := defaultVolumeSizeInBytes
+	if v := volumeContext[ephemeralSizeAttribute]; v != "" {
+		quantity, err := resource.ParseQuantity(v)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid %q attribute %q: %v", ephemeralSizeAttribute, v, err)
+		}
+		size = quantity.Value()
+	}
+	size = (size + giB - 1) / giB * giB
+	if size < minimumVolumeSizeInBytes {
+		size = minimumVolumeSizeInBytes
+	}
+	if d.ephemeralMaxSize > 0 && size > d.ephemeralMaxSize {
+		return 0, "", fmt.Errorf("size %v exceeds the maximum size of ephemeral volumes (%v)", formatBytes(size), formatBytes(d.ephemeralMaxSize))
+	}
+
+	volumeType := volumeContext[ephemeralTypeAttribute]
+	if volumeType == "" {
+		return size, d.ephemeralVolumeTypes[0], nil
+	}
+	for _, allowed := range d.ephemeralVolumeTypes {
+		if strings.EqualFold(allowed, volumeType) {
+			return size, volumeType, nil
+		}
+	}
+	return 0, "", fmt.Errorf("volume type %q is not allowed for ephemeral volumes, allowed are %s", volumeType, strings.Join(d.ephemeralVolumeTypes, ", "))
+}
+
+// isEphemeralVolumeOfNode returns whether the volume was created by this
+// node for an inline ephemeral volume.
+func (d *Driver) isEphemeralVolumeOfNode(vol *iaas.Volume) bool {
+	return vol.Labels[ephemeralLabel] == "true" && vol.Labels[ephemeralNodeLabel] == d.nodeID
+}
+
+// nodePublishEphemeralVolume creates the volume of an inline ephemeral
+// volume, attaches it to the machine of this node, and formats and mounts it
+// to the target path. The volume is deleted again by NodeUnpublishVolume.
+func (d *Driver) nodePublishEphemeralVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	if !d.ephemeralVolumesEnabled() {
+		return nil, status.Error(codes.FailedPrecondition, "NodePublishVolume ephemeral volumes are not enabled on this node")
+	}
+
+	if req.VolumeCapability.GetMount() == nil {
+		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume ephemeral volumes only support the filesystem volume mode")
+	}
+
+	// a new volume is empty and read only volumes are never formatted
+	if req.Readonly {
+		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume ephemeral volumes can not be mounted read only")
+	}
+
+	size, volumeType, err := d.ephemeralVolumeOptions(req.VolumeContext)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "NodePublishVolume %v", err)
+	}
+
+	log := d.log.With("volume_id", req.VolumeId, "target_path", req.TargetPath, "volume_type", volumeType,
+		"storage_size_giga_bytes", size/giB, "method", "node_publish_ephemeral_volume")
+	log.Info("node publish ephemeral volume called")
+
+	vol, err := d.findVolumeByCSIName(ctx, req.VolumeId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed to look up ephemeral volume: %v", err)
+	}
+	if vol != nil && !d.isEphemeralVolumeOfNode(vol) {
+		return nil, status.Errorf(codes.FailedPrecondition, "NodePublishVolume volume %q is not an ephemeral volume of node %q", vol.Identity, d.nodeID)
+	}
+
+	if vol == nil {
+		vol, err = d.createEphemeralVolume(ctx, req, size, volumeType, log)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Info("ephemeral volume already exists", "volume_identity", vol.Identity)
+	}
+
+	log = log.With("volume_identity", vol.Identity)
+	if !strings.EqualFold(vol.Status, "attached") {
+		log.Info("waiting until the ephemeral volume is available")
+		if err := wait.PollUntilContextTimeout(ctx, 5*time.Second, 5*time.Minute, true, func(ctx context.Context) (bool, error) {
+			current, err := d.iaas.GetVolume(ctx, vol.Identity)
+			if err != nil {
+				return false, fmt.Errorf("error getting volume: %w", err)
+			}
+			return strings.EqualFold(current.Status, "available") || strings.EqualFold(current.Status, "attached"), nil
+		}); err != nil {
+			return nil, status.Errorf(codes.Unavailable, "NodePublishVolume ephemeral volume %q is not available: %v", vol.Identity, err)
+		}
+	}
+
+	published, err := d.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         vol.Identity,
+		NodeId:           d.nodeID,
+		VolumeCapability: req.VolumeCapability,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the device is mounted to the target path directly, as inline
+	// ephemeral volumes are not staged
+	if _, err := d.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+		VolumeId:          vol.Identity,
+		PublishContext:    published.PublishContext,
+		StagingTargetPath: req.TargetPath,
+		VolumeCapability:  req.VolumeCapability,
+		VolumeContext:     req.VolumeContext,
+	}); err != nil {
+		return nil, err
+	}
+
+	log.Info("ephemeral volume was published")
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// createEphemeralVolume creates the volume of an inline ephemeral volume,
+// labelled with this node.
+func (d *Driver) createEphemeralVolume(ctx context.Context, req *csi.NodePublishVolumeRequest, size int64, volumeType string, log *slog.Logger) (*iaas.Volume, error) {
+	volumeTypeIdentity, err := d.resolveVolumeTypeIdentity(ctx, volumeType)
+	if err != nil {
+		return nil, err
+	}
+
+	volumeReq, err := d.buildCreateVolumeRequest(&csi.CreateVolumeRequest{Name: req.VolumeId}, req.VolumeId, size, volumeTypeIdentity)
+	if err != nil {
+		return nil, err
+	}
+	volumeReq.Labels[ephemeralLabel] = "true"
+	volumeReq.Labels[ephemeralNodeLabel] = d.nodeID
+	volumeReq.Annotations[ephemeralTargetPathAnnotation] = req.TargetPath
+	if fsType := req.VolumeCapability.GetMount().GetFsType(); fsType != "" {
+		volumeReq.Annotations["k8s.thalassa.cloud/fstype"] = fsType
+	}
+
+	log.With("volume_req", volumeReq).Info("creating ephemeral volume")
+	vol, err := d.iaas.CreateVolume(ctx, volumeReq)
+	if err != nil {
+		log.Error("failed to create ephemeral volume", "error", err)
+		return nil, status.Errorf(codes.Internal, "NodePublishVolume failed to create ephemeral volume: %v", err)
+	}
+	return vol, nil
+}
+
+// nodeUnpublishEphemeralVolume detaches and deletes the volume of an inline
+// ephemeral volume after it was unmounted. Volumes that are not ephemeral
+// volumes of this node are left alone.
+func (d *Driver) nodeUnpublishEphemeralVolume(ctx context.Context, volumeHandle string, log *slog.Logger) error {
+	// the kubelet generates the handles of inline ephemeral volumes, other
+	// volumes are not looked up
+	if !d.ephemeralVolumesEnabled() || !strings.HasPrefix(volumeHandle, ephemeralVolumeHandlePrefix) {
+		return nil
+	}
+
+	vol, err := d.findVolumeByCSIName(ctx, volumeHandle)
+	if err != nil {
+		return status.Errorf(codes.Internal, "NodeUnpublishVolume failed to look up ephemeral volume: %v", err)
+	}
+	if vol == nil || !d.isEphemeralVolumeOfNode(vol) {
+		return nil
+	}
+
+	return d.deleteEphemeralVolume(ctx, vol, log)
+}
+
+// deleteEphemeralVolume detaches the ephemeral volume from the machine of
+// this node and deletes it.
+func (d *Driver) deleteEphemeralVolume(ctx context.Context, vol *iaas.Volume, log *slog.Logger) error {
+	log = log.With("volume_identity", vol.Identity)
+
+	log.Info("detaching ephemeral volume")
+	if _, err := d.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: vol.Identity,
+		NodeId:   d.nodeID,
+	}); err != nil {
+		return err
+	}
+	d.clearVolumeCondition(vol.Identity)
+
+	log.Info("deleting ephemeral volume")
+	if err := d.iaas.DeleteVolume(ctx, vol.Identity); err != nil && !client.IsNotFound(err) {
+		return status.Errorf(codes.Internal, "failed to delete ephemeral volume %q: %v", vol.Identity, err)
+	}
+	log.Info("ephemeral volume was deleted")
+	return nil
+}
+
+// sweepEphemeralVolumes deletes the ephemeral volumes of this node that are
+// no longer mounted, e.g. because the node plugin was not running when their
+// pod was deleted.
+func (d *Driver) sweepEphemeralVolumes(ctx context.Context) error {
+	log := d.log.With("method", "sweep_ephemeral_volumes")
+
+	volumes, err := d.iaas.ListVolumes(ctx, &iaas.ListVolumesRequest{
+		Filters: []filters.Filter{
+			&filters.FilterKeyValue{
+				Key:   filters.FilterRegion,
+				Value: d.region,
+			},
+			&filters.LabelFilter{
+				MatchLabels: map[string]string{
+					"k8s.thalassa.cloud/csi-driver-name": d.name,
+					ephemeralLabel:                       "true",
+					ephemeralNodeLabel:                   d.nodeID,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list ephemeral volumes: %w", err)
+	}
+
+	var errs []string
+	for _, vol := range volumes {
+		if !d.isEphemeralVolumeOfNode(&vol) || time.Since(vol.CreatedAt) < ephemeralSweepGracePeriod {
+			continue
+		}
+
+		if target := vol.Annotations[ephemeralTargetPathAnnotation]; target != "" {
+			mounted, err := d.mounter.IsMounted(target)
+			if err != nil {
+				log.Warn("failed to check whether the ephemeral volume is mounted", "volume_identity", vol.Identity, "target_path", target, "error", err)
+				continue
+			}
+			if mounted {
+				continue
+			}
+		}
+
+		log.Info("deleting leaked ephemeral volume", "volume_identity", vol.Identity)
+		if err := d.deleteEphemeralVolume(ctx, &vol, log); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", vol.Identity, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete ephemeral volumes: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// runEphemeralVolumeSweeper sweeps the leaked ephemeral volumes of this node
+// until the context is done.
+func (d *Driver) runEphemeralVolumeSweeper(ctx context.Context) {
+	ticker := time.NewTicker(d.ephemeralSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.sweepEphemeralVolumes(ctx); err != nil {
+				d.log.Error("sweeping ephemeral volumes failed", "error", err)
+			}
+		}
+	}
+}
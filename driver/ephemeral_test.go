@@ -0,0 +1,246 @@
+package driver
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+	"github.com/thalassa-cloud/client-go/iaas"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEphemeralVolumeOptions(t *testing.T) {
+	driver := &Driver{
+		ephemeralVolumeTypes: []string{"block", "Premium"},
+		ephemeralMaxSize:     50 * giB,
+	}
+
+	tests := []struct {
+		name          string
+		volumeContext map[string]string
+		wantSize      int64
+		wantType      string
+		wantErr       string
+	}{
+		{
+			name:     "defaults",
+			wantSize: defaultVolumeSizeInBytes,
+			wantType: "block",
+		},
+		{
+			name:          "size and type",
+			volumeContext: map[string]string{"size": "20Gi", "type": "premium"},
+			wantSize:      20 * giB,
+			wantType:      "premium",
+		},
+		{
+			name:          "size is rounded up to whole GiB",
+			volumeContext: map[string]string{"size": "1500Mi"},
+			wantSize:      2 * giB,
+			wantType:      "block",
+		},
+		{
+			name:          "size exceeds the maximum",
+			volumeContext: map[string]string{"size": "51Gi"},
+			wantErr:       "size 51Gi exceeds the maximum size of ephemeral volumes (50Gi)",
+		},
+		{
+			name:          "invalid size",
+			volumeContext: map[string]string{"size": "large"},
+			wantErr:       `invalid "size" attribute "large"`,
+		},
+		{
+			name:          "type not allowed",
+			volumeContext: map[string]string{"type": "fast"},
+			wantErr:       `volume type "fast" is not allowed for ephemeral volumes, allowed are block, Premium`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, volumeType, err := driver.ephemeralVolumeOptions(tt.volumeContext)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantSize, size)
+			require.Equal(t, tt.wantType, volumeType)
+		})
+	}
+}
+
+func TestNodePublishEphemeralVolume(t *testing.T) {
+	mountCapability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+	blockCapability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+	_, iaasClient := newFakeAPI(t, nil)
+
+	tests := []struct {
+		name       string
+		driver     *Driver
+		capability *csi.VolumeCapability
+		attributes map[string]string
+		readonly   bool
+		wantCode   codes.Code
+	}{
+		{
+			name:       "not enabled",
+			driver:     &Driver{},
+			capability: mountCapability,
+			wantCode:   codes.FailedPrecondition,
+		},
+		{
+			name:       "block volume mode",
+			driver:     &Driver{iaas: iaasClient, ephemeralVolumeTypes: []string{"block"}},
+			capability: blockCapability,
+			wantCode:   codes.InvalidArgument,
+		},
+		{
+			name:       "type not allowed",
+			driver:     &Driver{iaas: iaasClient, ephemeralVolumeTypes: []string{"block"}},
+			capability: mountCapability,
+			attributes: map[string]string{"type": "premium"},
+			wantCode:   codes.InvalidArgument,
+		},
+		{
+			name:       "read only",
+			driver:     &Driver{iaas: iaasClient, ephemeralVolumeTypes: []string{"block"}},
+			capability: mountCapability,
+			readonly:   true,
+			wantCode:   codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.driver.log = slog.New(slog.NewTextHandler(os.Stdout, nil))
+			tt.driver.mounter = NewMockMounter()
+
+			volumeContext := map[string]string{ephemeralContextKey: "true"}
+			for k, v := range tt.attributes {
+				volumeContext[k] = v
+			}
+
+			// ephemeral volumes have no staging target path
+			_, err := tt.driver.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+				VolumeId:         "csi-0123456789abcdef",
+				TargetPath:       "/tmp/target",
+				VolumeCapability: tt.capability,
+				VolumeContext:    volumeContext,
+				Readonly:         tt.readonly,
+			})
+			require.Equal(t, tt.wantCode, status.Code(err), err)
+		})
+	}
+}
+
+func TestNodePublishEphemeralVolumeCreatesVolume(t *testing.T) {
+	const (
+		volumeHandle = "csi-0123456789abcdef"
+		targetPath   = "/var/lib/kubelet/pods/pod-1/volumes/kubernetes.io~csi/scratch/mount"
+	)
+
+	api, iaasClient := newFakeAPI(t, nil)
+	api.volumeTypes["vt-1"] = &iaas.VolumeType{Identity: "vt-1", Name: "block"}
+	api.machines = []iaas.Machine{{Identity: "vm-1", Name: "node-1"}}
+
+	mockMounter := NewMockMounter()
+	driver := &Driver{
+		name:                 "csi.thalassa.cloud",
+		nodeID:               "node-1",
+		iaas:                 iaasClient,
+		mounter:              mockMounter,
+		log:                  slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		ephemeralVolumeTypes: []string{"block"},
+	}
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId:   volumeHandle,
+		TargetPath: targetPath,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		},
+		VolumeContext: map[string]string{ephemeralContextKey: "true", "size": "5Gi"},
+	}
+
+	_, err := driver.NodePublishVolume(context.Background(), req)
+	require.NoError(t, err)
+
+	created := api.Created()
+	require.Len(t, created, 1)
+	require.Equal(t, "vt-1", created[0].VolumeTypeIdentity)
+	require.Equal(t, 5, created[0].Size)
+	require.Equal(t, volumeHandle, created[0].Labels[csiVolumeNameLabel])
+	require.Equal(t, "true", created[0].Labels[ephemeralLabel])
+	require.Equal(t, "node-1", created[0].Labels[ephemeralNodeLabel])
+	require.Equal(t, targetPath, created[0].Annotations[ephemeralTargetPathAnnotation])
+
+	vol := api.volumes["vol-1"]
+	require.Equal(t, "attached", vol.Status)
+	require.Len(t, vol.Attachments, 1)
+	require.Equal(t, "vm-1", vol.Attachments[0].AttachedToIdentity)
+
+	device := getDeviceByIDPath("vol-1")
+	require.Equal(t, defaultFsType, mockMounter.FormattedDevices[device])
+	require.Equal(t, device, mockMounter.MountPoints[targetPath])
+
+	// publishing again finds the volume of the handle and leaves it as is
+	_, err = driver.NodePublishVolume(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, api.Created(), 1)
+	require.Len(t, vol.Attachments, 1)
+	require.Equal(t, device, mockMounter.MountPoints[targetPath])
+}
+
+func TestSweepEphemeralVolumes(t *testing.T) {
+	ephemeralVolume := func(identity, node, target string, createdAt time.Time) *iaas.Volume {
+		return &iaas.Volume{
+			Identity:  identity,
+			Status:    "available",
+			CreatedAt: createdAt,
+			Labels: iaas.Labels{
+				"k8s.thalassa.cloud/csi-driver-name": "csi.thalassa.cloud",
+				ephemeralLabel:                       "true",
+				ephemeralNodeLabel:                   node,
+			},
+			Annotations: iaas.Annotations{
+				ephemeralTargetPathAnnotation: target,
+			},
+		}
+	}
+
+	old := time.Now().Add(-time.Hour)
+	volumes := map[string]*iaas.Volume{
+		"vol-leaked":     ephemeralVolume("vol-leaked", "node-1", "/pods/a/mount", old),
+		"vol-mounted":    ephemeralVolume("vol-mounted", "node-1", "/pods/b/mount", old),
+		"vol-new":        ephemeralVolume("vol-new", "node-1", "/pods/c/mount", time.Now()),
+		"vol-other-node": ephemeralVolume("vol-other-node", "node-2", "/pods/d/mount", old),
+	}
+	api, iaasClient := newFakeAPI(t, volumes)
+
+	mockMounter := NewMockMounter()
+	mockMounter.MountPoints["/pods/b/mount"] = "/dev/sdb"
+
+	driver := &Driver{
+		name:                 "csi.thalassa.cloud",
+		nodeID:               "node-1",
+		iaas:                 iaasClient,
+		mounter:              mockMounter,
+		log:                  slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		ephemeralVolumeTypes: []string{"block"},
+	}
+
+	require.NoError(t, driver.sweepEphemeralVolumes(context.Background()))
+	require.Equal(t, []string{"vol-leaked"}, api.Deleted())
+}
@@ -22,14 +22,16 @@ import (
 
 // Error types for the node driver
 var (
-	ErrDeviceNotFound     = fmt.Errorf("device not found")
-	ErrDeviceNotAttached  = fmt.Errorf("device not attached")
-	ErrDeviceNotFormatted = fmt.Errorf("device not formatted")
-	ErrMountFailed        = fmt.Errorf("mount failed")
-	ErrUnmountFailed      = fmt.Errorf("unmount failed")
-	ErrInvalidPath        = fmt.Errorf("invalid path")
-	ErrInvalidVolumeID    = fmt.Errorf("invalid volume ID")
-	ErrInvalidMountPoint  = fmt.Errorf("invalid mount point")
+	ErrDeviceNotFound       = fmt.Errorf("device not found")
+	ErrDeviceNotAttached    = fmt.Errorf("device not attached")
+	ErrDeviceNotFormatted   = fmt.Errorf("device not formatted")
+	ErrDeviceSerialMismatch = fmt.Errorf("device serial mismatch")
+	ErrPartitionNotFound    = fmt.Errorf("partition not found")
+	ErrMountFailed          = fmt.Errorf("mount failed")
+	ErrUnmountFailed        = fmt.Errorf("unmount failed")
+	ErrInvalidPath          = fmt.Errorf("invalid path")
+	ErrInvalidVolumeID      = fmt.Errorf("invalid volume ID")
+	ErrInvalidMountPoint    = fmt.Errorf("invalid mount point")
 )
 
 // DeviceError represents an error related to device operations
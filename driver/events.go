@@ -0,0 +1,117 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// eventRecorder records Kubernetes events for the PVC of a volume.
+type eventRecorder interface {
+	Event(ctx context.Context, pvcNamespace, pvcName, eventType, reason, message string) error
+}
+
+// kubeEventRecorder records events using the Kubernetes API.
+type kubeEventRecorder struct {
+	client    kubernetes.Interface
+	component string
+	host      string
+}
+
+// newKubeEventRecorder returns an event recorder with a Kubernetes client for
+// the kube config, or the in cluster config when it is empty.
+func newKubeEventRecorder(kubeConfig, component, host string) (*kubeEventRecorder, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build kube config: %s", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build kubernetes client: %s", err)
+	}
+	return &kubeEventRecorder{
+		client:    client,
+		component: component,
+		host:      host,
+	}, nil
+}
+
+func (r *kubeEventRecorder) Event(ctx context.Context, pvcNamespace, pvcName, eventType, reason, message string) error {
+	client := r.client
+
+	// the UID is required for the event to show up on the PVC
+	pvc, err := client.CoreV1().PersistentVolumeClaims(pvcNamespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get persistent volume claim: %s", err)
+	}
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: pvc.Name + ".",
+			Namespace:    pvc.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "PersistentVolumeClaim",
+			Namespace:       pvc.Namespace,
+			Name:            pvc.Name,
+			UID:             pvc.UID,
+			ResourceVersion: pvc.ResourceVersion,
+		},
+		Type:    eventType,
+		Reason:  reason,
+		Message: message,
+		Source: corev1.EventSource{
+			Component: r.component,
+			Host:      r.host,
+		},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: r.component,
+		ReportingInstance:   r.component + "-" + r.host,
+	}
+
+	if _, err := client.CoreV1().Events(pvc.Namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create event: %s", err)
+	}
+	return nil
+}
+
+// recordVolumeEvent records an event for the PVC of the volume. The PVC is
+// known from the volume context for volumes provisioned with the extra create
+// metadata, for other volumes the event is only logged.
+func (d *Driver) recordVolumeEvent(ctx context.Context, volumeContext map[string]string, eventType, reason, message string) {
+	log := d.log.With("event_type", eventType, "reason", reason, "message", message)
+
+	pvcNamespace, pvcName := volumeContext[pvcNamespaceKey], volumeContext[pvcNameKey]
+	if d.eventRecorder == nil || pvcNamespace == "" || pvcName == "" {
+		log.Info("not recording event, the persistent volume claim is unknown")
+		return
+	}
+
+	if err := d.eventRecorder.Event(ctx, pvcNamespace, pvcName, eventType, reason, message); err != nil {
+		log.Warn("failed to record event", "pvc_namespace", pvcNamespace, "pvc_name", pvcName, "error", err)
+	}
+}
@@ -0,0 +1,223 @@
+package driver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/thalassa-cloud/client-go/iaas"
+	"github.com/thalassa-cloud/client-go/pkg/client"
+)
+
+// fakeAPI is a fake Thalassa API that creates, lists, gets, updates,
+// attaches and deletes the volumes, creates, lists and gets the snapshots,
+// and lists the volume types and machines. Attached volumes are attached
+// right away, created snapshots stay creating.
+type fakeAPI struct {
+	mu          sync.Mutex
+	volumes     map[string]*iaas.Volume
+	volumeTypes map[string]*iaas.VolumeType
+	machines    []iaas.Machine
+	snapshots   map[string]*iaas.Snapshot
+
+	// onGetVolume is called before a volume is returned, for example to
+	// change it like a concurrent writer would
+	onGetVolume func(vol *iaas.Volume)
+	// onGetSnapshot is called before a snapshot is returned, for example to
+	// change its status
+	onGetSnapshot func(snapshot *iaas.Snapshot)
+
+	created []iaas.CreateVolume
+	updates []iaas.UpdateVolume
+	deleted []string
+}
+
+// newFakeAPI returns a fake API that serves the volumes and an API client
+// for it. Volume types and hooks can be set on the fake API before it is
+// used.
+func newFakeAPI(t *testing.T, volumes map[string]*iaas.Volume) (*fakeAPI, *iaas.Client) {
+	t.Helper()
+
+	if volumes == nil {
+		volumes = map[string]*iaas.Volume{}
+	}
+	api := &fakeAPI{
+		volumes:     volumes,
+		volumeTypes: map[string]*iaas.VolumeType{},
+		snapshots:   map[string]*iaas.Snapshot{},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.serveHTTP(t, w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	tcClient, err := client.NewClient(client.WithBaseURL(srv.URL), client.WithAuthNone())
+	require.NoError(t, err)
+	iaasClient, err := iaas.New(tcClient)
+	require.NoError(t, err)
+	return api, iaasClient
+}
+
+func (api *fakeAPI) serveHTTP(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == iaas.VolumeEndpoint && r.Method == http.MethodGet:
+		list := []iaas.Volume{}
+		for _, vol := range api.volumes {
+			list = append(list, *vol)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(list))
+		return
+	case r.URL.Path == iaas.VolumeEndpoint && r.Method == http.MethodPost:
+		var create iaas.CreateVolume
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&create))
+		api.created = append(api.created, create)
+		vol := &iaas.Volume{
+			Identity:    "vol-" + strconv.Itoa(len(api.created)),
+			Name:        create.Name,
+			Description: create.Description,
+			Labels:      create.Labels,
+			Annotations: create.Annotations,
+			Size:        create.Size,
+			Status:      "available",
+		}
+		api.volumes[vol.Identity] = vol
+		require.NoError(t, json.NewEncoder(w).Encode(vol))
+		return
+	case r.URL.Path == iaas.VolumeTypeEndpoint && r.Method == http.MethodGet:
+		list := []iaas.VolumeType{}
+		for _, volumeType := range api.volumeTypes {
+			list = append(list, *volumeType)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(list))
+		return
+	case strings.HasPrefix(r.URL.Path, iaas.VolumeTypeEndpoint+"/") && r.Method == http.MethodGet:
+		volumeType, ok := api.volumeTypes[strings.TrimPrefix(r.URL.Path, iaas.VolumeTypeEndpoint+"/")]
+		if !ok {
+			http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(volumeType))
+		return
+	case r.URL.Path == iaas.SnapshotEndpoint && r.Method == http.MethodGet:
+		list := []iaas.Snapshot{}
+		for _, snapshot := range api.snapshots {
+			list = append(list, *snapshot)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(list))
+		return
+	case r.URL.Path == iaas.SnapshotEndpoint && r.Method == http.MethodPost:
+		var create iaas.CreateSnapshotRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&create))
+		snapshot := &iaas.Snapshot{
+			Identity:       "snap-" + strconv.Itoa(len(api.snapshots)+1),
+			Name:           create.Name,
+			Labels:         create.Labels,
+			Annotations:    create.Annotations,
+			Status:         iaas.SnapshotStatusCreating,
+			SourceVolumeId: &create.VolumeIdentity,
+		}
+		if vol, ok := api.volumes[create.VolumeIdentity]; ok {
+			snapshot.SourceVolume = vol
+			snapshot.SizeGB = &vol.Size
+		}
+		api.snapshots[snapshot.Identity] = snapshot
+		// like the API, the response does not include the source volume
+		// and size
+		require.NoError(t, json.NewEncoder(w).Encode(iaas.Snapshot{
+			Identity: snapshot.Identity,
+			Name:     snapshot.Name,
+			Status:   snapshot.Status,
+		}))
+		return
+	case strings.HasPrefix(r.URL.Path, iaas.SnapshotEndpoint+"/") && r.Method == http.MethodGet:
+		snapshot, ok := api.snapshots[strings.TrimPrefix(r.URL.Path, iaas.SnapshotEndpoint+"/")]
+		if !ok {
+			http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+			return
+		}
+		if api.onGetSnapshot != nil {
+			api.onGetSnapshot(snapshot)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(snapshot))
+		return
+	case r.URL.Path == iaas.MachineEndpoint && r.Method == http.MethodGet:
+		require.NoError(t, json.NewEncoder(w).Encode(append([]iaas.Machine{}, api.machines...)))
+		return
+	case !strings.HasPrefix(r.URL.Path, iaas.VolumeEndpoint+"/"):
+		http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+		return
+	}
+
+	identity, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, iaas.VolumeEndpoint+"/"), "/")
+	vol, ok := api.volumes[identity]
+	switch {
+	case !ok:
+		http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+	case action == "attach" && r.Method == http.MethodPost:
+		var attach iaas.AttachVolumeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&attach))
+		attachment := iaas.VolumeAttachment{
+			Identity:               "att-" + identity,
+			Serial:                 identity,
+			AttachedToIdentity:     attach.ResourceIdentity,
+			AttachedToResourceType: attach.ResourceType,
+		}
+		vol.Attachments = append(vol.Attachments, attachment)
+		vol.Status = "attached"
+		require.NoError(t, json.NewEncoder(w).Encode(attachment))
+	case action != "":
+		http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+	case r.Method == http.MethodGet:
+		if api.onGetVolume != nil {
+			api.onGetVolume(vol)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(vol))
+	case r.Method == http.MethodPut:
+		var update iaas.UpdateVolume
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+		api.updates = append(api.updates, update)
+		vol.Name = update.Name
+		vol.Description = update.Description
+		vol.Labels = update.Labels
+		vol.Annotations = update.Annotations
+		vol.Size = update.Size
+		vol.DeleteProtection = update.DeleteProtection
+		require.NoError(t, json.NewEncoder(w).Encode(vol))
+	case r.Method == http.MethodDelete:
+		delete(api.volumes, identity)
+		api.deleted = append(api.deleted, identity)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+	}
+}
+
+// Created returns the volumes the API created.
+func (api *fakeAPI) Created() []iaas.CreateVolume {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return append([]iaas.CreateVolume{}, api.created...)
+}
+
+// Updates returns the updates of volumes the API received.
+func (api *fakeAPI) Updates() []iaas.UpdateVolume {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return append([]iaas.UpdateVolume{}, api.updates...)
+}
+
+// Deleted returns the identities of the deleted volumes.
+func (api *fakeAPI) Deleted() []string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return append([]string{}, api.deleted...)
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// StorageClass parameters to check, and optionally repair, an existing
+	// filesystem before it is mounted. They are passed to the node via the
+	// volume context.
+	fsCheckParameter  = "fs-check"
+	fsRepairParameter = "fs-repair"
+)
+
+var (
+	// These annotations can be added to the volume attributes of a PV to
+	// enable the filesystem check and repair for volumes that were not
+	// provisioned with the StorageClass parameters, e.g. static volumes.
+	annsFsCheckVolume = []string{
+		"csi.k8s.thalassa.cloud/fs-check",
+	}
+	annsFsRepairVolume = []string{
+		"csi.k8s.thalassa.cloud/fs-repair",
+	}
+)
+
+// fsckParameters lists the filesystem check parameters that are passed from
+// CreateVolume to NodeStageVolume via the volume context.
+var fsckParameters = []string{
+	fsCheckParameter,
+	fsRepairParameter,
+}
+
+// fsckStatus is the outcome of a filesystem check.
+type fsckStatus string
+
+const (
+	// fsckClean means no errors were found.
+	fsckClean fsckStatus = "clean"
+	// fsckRepaired means errors were found and repaired.
+	fsckRepaired fsckStatus = "repaired"
+	// fsckErrors means errors were found and left unrepaired.
+	fsckErrors fsckStatus = "errors"
+	// fsckDirtyLog means the filesystem log has to be replayed by mounting
+	// the filesystem before it can be checked.
+	fsckDirtyLog fsckStatus = "dirty-log"
+)
+
+// fsckResult is the result of checking a filesystem.
+type fsckResult struct {
+	Status fsckStatus
+	Output string
+}
+
+// fsckOptions returns whether the filesystem check and repair are enabled
+// for the volume context, either by the StorageClass parameters or by the
+// volume annotations. Repair implies check.
+func fsckOptions(volumeContext map[string]string) (check, repair bool, err error) {
+	check, err = boolParameter(volumeContext, append([]string{fsCheckParameter}, annsFsCheckVolume...))
+	if err != nil {
+		return false, false, err
+	}
+	repair, err = boolParameter(volumeContext, append([]string{fsRepairParameter}, annsFsRepairVolume...))
+	if err != nil {
+		return false, false, err
+	}
+	return check || repair, repair, nil
+}
+
+// boolParameter returns the value of the first of the parameters or
+// annotations present in the volume context, or false if none is present.
+func boolParameter(volumeContext map[string]string, params []string) (bool, error) {
+	for _, p := range params {
+		v, ok := volumeContext[p]
+		if !ok {
+			continue
+		}
+		// annotations only need to be present, like the noformat annotation
+		if v == "" {
+			return true, nil
+		}
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("parameter %q must be a boolean, got %q", p, v)
+		}
+		return enabled, nil
+	}
+	return false, nil
+}
+
+// fsckCommand returns the command that checks, or repairs, the filesystem
+// on the source device. ext filesystems are not force checked, so e2fsck only
+// does a full check when the filesystem is marked as having errors, which
+// keeps staging large volumes fast. Repairing btrfs is not supported, as
+// `btrfs check --repair` is not considered safe for unattended use.
+func fsckCommand(fsType, source string, repair bool) (string, []string, error) {
+	switch fsType {
+	case "ext3", "ext4":
+		if repair {
+			return "e2fsck", []string{"-y", source}, nil
+		}
+		return "e2fsck", []string{"-n", source}, nil
+	case "xfs":
+		if repair {
+			return "xfs_repair", []string{source}, nil
+		}
+		return "xfs_repair", []string{"-n", source}, nil
+	case "btrfs":
+		if repair {
+			return "", nil, fmt.Errorf("repairing %s filesystems is not supported", fsType)
+		}
+		return "btrfs", []string{"check", "--readonly", source}, nil
+	}
+	return "", nil, fmt.Errorf("checking %s filesystems is not supported", fsType)
+}
+
+// fsckStatusFromExitCode maps the exit code of the filesystem check command
+// to its outcome. Exit codes that indicate the check itself failed are
+// returned as an error.
+func fsckStatusFromExitCode(fsType string, exitCode int) (fsckStatus, error) {
+	switch fsType {
+	case "ext3", "ext4":
+		// see e2fsck(8), the exit code is the sum of the conditions
+		switch {
+		case exitCode == 0:
+			return fsckClean, nil
+		case exitCode&^(1|2) == 0:
+			return fsckRepaired, nil
+		case exitCode&^(1|2|4) == 0:
+			return fsckErrors, nil
+		}
+	case "xfs":
+		// see xfs_repair(8), 1 means corruption was found in no-modify
+		// mode and 2 that the log needs to be replayed
+		switch exitCode {
+		case 0:
+			// xfs_repair does not report whether it repaired anything
+			return fsckClean, nil
+		case 1:
+			return fsckErrors, nil
+		case 2:
+			return fsckDirtyLog, nil
+		}
+	case "btrfs":
+		switch exitCode {
+		case 0:
+			return fsckClean, nil
+		case 1:
+			return fsckErrors, nil
+		}
+	}
+	return "", fmt.Errorf("filesystem check exited with status %d", exitCode)
+}
+
+// fsckVolumeCondition returns the volume condition reported for the outcome
+// of the filesystem check.
+func fsckVolumeCondition(result fsckResult) *csi.VolumeCondition {
+	switch result.Status {
+	case fsckErrors:
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  "filesystem check found errors that were not repaired",
+		}
+	case fsckRepaired:
+		return &csi.VolumeCondition{
+			Message: "filesystem check found errors that were repaired",
+		}
+	case fsckDirtyLog:
+		return &csi.VolumeCondition{
+			Message: "filesystem log needs to be replayed by mounting, the filesystem was not checked",
+		}
+	}
+	return &csi.VolumeCondition{
+		Message: "filesystem check found no errors",
+	}
+}
+
+// checkFilesystem checks, and optionally repairs, the filesystem on the
+// source device before it is mounted. The outcome is reported as an event and
+// as the volume condition. Mounting is only refused when the repair failed,
+// errors found by a check without repair are reported but left for the
+// filesystem to handle.
+func (d *Driver) checkFilesystem(ctx context.Context, volumeID string, volumeContext map[string]string, source, fsType string, repair bool, log *slog.Logger) error {
+	if _, _, err := fsckCommand(fsType, source, repair); err != nil && repair {
+		log.Warn("filesystem can not be repaired, only checking it", "error", err)
+		repair = false
+	}
+
+	log = log.With("repair", repair)
+	log.Info("checking the filesystem before mounting")
+
+	result, err := d.mounter.Check(source, fsType, repair)
+	if err != nil {
+		// failing to run the check should not make the volume unusable
+		log.Warn("filesystem check failed", "error", err)
+		d.recordVolumeEvent(ctx, volumeContext, corev1.EventTypeWarning, "FilesystemCheckFailed",
+			fmt.Sprintf("Filesystem check of volume %s failed: %v", volumeID, err))
+		return nil
+	}
+
+	condition := fsckVolumeCondition(result)
+	d.setVolumeCondition(volumeID, condition)
+
+	log = log.With("fsck_status", result.Status)
+	switch result.Status {
+	case fsckErrors:
+		log.Warn("filesystem check found errors", "output", result.Output)
+		d.recordVolumeEvent(ctx, volumeContext, corev1.EventTypeWarning, "FilesystemErrors",
+			fmt.Sprintf("Volume %s: %s", volumeID, condition.Message))
+		if repair {
+			return status.Errorf(codes.Internal, "NodeStageVolume filesystem of volume %q has errors that could not be repaired", volumeID)
+		}
+	case fsckRepaired:
+		log.Info("filesystem check repaired errors", "output", result.Output)
+		d.recordVolumeEvent(ctx, volumeContext, corev1.EventTypeNormal, "FilesystemRepaired",
+			fmt.Sprintf("Volume %s: %s", volumeID, condition.Message))
+	default:
+		log.Info(condition.Message)
+	}
+	return nil
+}
+
+// setVolumeCondition stores the condition of a staged volume.
+func (d *Driver) setVolumeCondition(volumeID string, condition *csi.VolumeCondition) {
+	d.volumeConditionsMu.Lock()
+	defer d.volumeConditionsMu.Unlock()
+	if d.volumeConditions == nil {
+		d.volumeConditions = make(map[string]*csi.VolumeCondition)
+	}
+	d.volumeConditions[volumeID] = condition
+}
+
+// stagedVolumeCondition returns the condition of a staged volume, or nil if
+// the filesystem was not checked.
+func (d *Driver) stagedVolumeCondition(volumeID string) *csi.VolumeCondition {
+	d.volumeConditionsMu.Lock()
+	defer d.volumeConditionsMu.Unlock()
+	return d.volumeConditions[volumeID]
+}
+
+// clearVolumeCondition removes the condition of an unstaged volume.
+func (d *Driver) clearVolumeCondition(volumeID string) {
+	d.volumeConditionsMu.Lock()
+	defer d.volumeConditionsMu.Unlock()
+	delete(d.volumeConditions, volumeID)
+}
@@ -0,0 +1,235 @@
+package driver
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type recordedEvent struct {
+	pvcNamespace, pvcName, eventType, reason string
+}
+
+type fakeEventRecorder struct {
+	events []recordedEvent
+}
+
+func (r *fakeEventRecorder) Event(ctx context.Context, pvcNamespace, pvcName, eventType, reason, message string) error {
+	r.events = append(r.events, recordedEvent{pvcNamespace, pvcName, eventType, reason})
+	return nil
+}
+
+func TestFsckOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		volumeContext map[string]string
+		wantCheck     bool
+		wantRepair    bool
+		wantErr       string
+	}{
+		{
+			name: "disabled by default",
+		},
+		{
+			name:          "check parameter",
+			volumeContext: map[string]string{fsCheckParameter: "true"},
+			wantCheck:     true,
+		},
+		{
+			name:          "repair implies check",
+			volumeContext: map[string]string{fsRepairParameter: "true"},
+			wantCheck:     true,
+			wantRepair:    true,
+		},
+		{
+			name:          "check annotation without value",
+			volumeContext: map[string]string{"csi.k8s.thalassa.cloud/fs-check": ""},
+			wantCheck:     true,
+		},
+		{
+			name:          "disabled check parameter",
+			volumeContext: map[string]string{fsCheckParameter: "false"},
+		},
+		{
+			name:          "invalid parameter",
+			volumeContext: map[string]string{fsRepairParameter: "always"},
+			wantErr:       `parameter "fs-repair" must be a boolean, got "always"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check, repair, err := fsckOptions(tt.volumeContext)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCheck, check)
+			require.Equal(t, tt.wantRepair, repair)
+		})
+	}
+}
+
+func TestFsckStatusFromExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsType   string
+		exitCode int
+		want     fsckStatus
+		wantErr  bool
+	}{
+		{name: "ext4 clean", fsType: "ext4", exitCode: 0, want: fsckClean},
+		{name: "ext4 errors corrected", fsType: "ext4", exitCode: 1, want: fsckRepaired},
+		{name: "ext4 errors corrected, reboot", fsType: "ext4", exitCode: 3, want: fsckRepaired},
+		{name: "ext4 errors left uncorrected", fsType: "ext4", exitCode: 4, want: fsckErrors},
+		{name: "ext4 operational error", fsType: "ext4", exitCode: 8, wantErr: true},
+		{name: "xfs clean", fsType: "xfs", exitCode: 0, want: fsckClean},
+		{name: "xfs corruption", fsType: "xfs", exitCode: 1, want: fsckErrors},
+		{name: "xfs dirty log", fsType: "xfs", exitCode: 2, want: fsckDirtyLog},
+		{name: "btrfs errors", fsType: "btrfs", exitCode: 1, want: fsckErrors},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fsckStatusFromExitCode(tt.fsType, tt.exitCode)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNodeStageVolumeFilesystemCheck(t *testing.T) {
+	devicePath := "/dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_test-volume"
+
+	tests := []struct {
+		name          string
+		volumeContext map[string]string
+		formatted     bool
+		result        fsckResult
+		wantChecked   bool
+		wantRepair    bool
+		wantAbnormal  bool
+		wantEvent     string
+		wantErr       error
+	}{
+		{
+			name:      "check disabled",
+			formatted: true,
+		},
+		{
+			name:          "new filesystem is not checked",
+			volumeContext: map[string]string{fsCheckParameter: "true"},
+		},
+		{
+			name:          "clean filesystem",
+			volumeContext: map[string]string{fsCheckParameter: "true"},
+			formatted:     true,
+			result:        fsckResult{Status: fsckClean},
+			wantChecked:   true,
+		},
+		{
+			name:          "errors are reported and the volume is mounted",
+			volumeContext: map[string]string{fsCheckParameter: "true"},
+			formatted:     true,
+			result:        fsckResult{Status: fsckErrors},
+			wantChecked:   true,
+			wantAbnormal:  true,
+			wantEvent:     "FilesystemErrors",
+		},
+		{
+			name:          "repaired filesystem",
+			volumeContext: map[string]string{fsRepairParameter: "true"},
+			formatted:     true,
+			result:        fsckResult{Status: fsckRepaired},
+			wantChecked:   true,
+			wantRepair:    true,
+			wantEvent:     "FilesystemRepaired",
+		},
+		{
+			name:          "repair failed",
+			volumeContext: map[string]string{fsRepairParameter: "true"},
+			formatted:     true,
+			result:        fsckResult{Status: fsckErrors},
+			wantChecked:   true,
+			wantRepair:    true,
+			wantAbnormal:  true,
+			wantEvent:     "FilesystemErrors",
+			wantErr:       status.Error(codes.Internal, `NodeStageVolume filesystem of volume "test-volume" has errors that could not be repaired`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMounter := NewMockMounter()
+			mockMounter.AttachedDevices[devicePath] = true
+			if tt.formatted {
+				mockMounter.FormattedDevices[devicePath] = "ext4"
+			}
+			mockMounter.CheckResults[devicePath] = tt.result
+
+			recorder := &fakeEventRecorder{}
+			driver := &Driver{
+				mounter:       mockMounter,
+				log:           slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				eventRecorder: recorder,
+			}
+
+			volumeContext := map[string]string{
+				pvcNameKey:      "data",
+				pvcNamespaceKey: "default",
+			}
+			for k, v := range tt.volumeContext {
+				volumeContext[k] = v
+			}
+
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "test-volume",
+				StagingTargetPath: "/tmp/staging",
+				VolumeContext:     volumeContext,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"},
+					},
+				},
+			})
+			if tt.wantErr != nil {
+				require.EqualError(t, err, tt.wantErr.Error())
+				require.NotContains(t, mockMounter.MountPoints, "/tmp/staging")
+			} else {
+				require.NoError(t, err)
+				require.Contains(t, mockMounter.MountPoints, "/tmp/staging")
+			}
+
+			repair, checked := mockMounter.CheckedDevices[devicePath]
+			require.Equal(t, tt.wantChecked, checked)
+			require.Equal(t, tt.wantRepair, repair)
+
+			condition := driver.stagedVolumeCondition("test-volume")
+			if !tt.wantChecked {
+				require.Nil(t, condition)
+			} else {
+				require.Equal(t, tt.wantAbnormal, condition.Abnormal)
+			}
+
+			if tt.wantEvent == "" {
+				require.Empty(t, recorder.events)
+			} else {
+				require.Len(t, recorder.events, 1)
+				require.Equal(t, "default", recorder.events[0].pvcNamespace)
+				require.Equal(t, "data", recorder.events[0].pvcName)
+				require.Equal(t, tt.wantEvent, recorder.events[0].reason)
+			}
+		})
+	}
+}
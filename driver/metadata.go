@@ -0,0 +1,170 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// Keys added to CreateVolume parameters by the external-provisioner when
+	// it runs with --extra-create-metadata
+	pvcNameKey      = "csi.storage.k8s.io/pvc/name"
+	pvcNamespaceKey = "csi.storage.k8s.io/pvc/namespace"
+	pvNameKey       = "csi.storage.k8s.io/pv/name"
+
+	// Keys added to CreateSnapshot parameters by the external-snapshotter when
+	// it runs with --extra-create-metadata
+	volumeSnapshotNameKey        = "csi.storage.k8s.io/volumesnapshot/name"
+	volumeSnapshotNamespaceKey   = "csi.storage.k8s.io/volumesnapshot/namespace"
+	volumeSnapshotContentNameKey = "csi.storage.k8s.io/volumesnapshotcontent/name"
+
+	// StorageClass and VolumeSnapshotClass parameters for per-resource metadata
+	labelsParameter           = "labels"
+	annotationsParameter      = "annotations"
+	descriptionParameter      = "description"
+	volumeNameParameter       = "volume-name"
+	deleteProtectionParameter = "delete-protection"
+
+	// Labels that link a Thalassa volume or snapshot to its Kubernetes objects
+	csiVolumeNameLabel             = "k8s.thalassa.cloud/csi-volume-name"
+	pvcNameLabel                   = "k8s.thalassa.cloud/pvc-name"
+	pvcNamespaceLabel              = "k8s.thalassa.cloud/pvc-namespace"
+	pvNameLabel                    = "k8s.thalassa.cloud/pv-name"
+	volumeSnapshotNameLabel        = "k8s.thalassa.cloud/volumesnapshot-name"
+	volumeSnapshotNamespaceLabel   = "k8s.thalassa.cloud/volumesnapshot-namespace"
+	volumeSnapshotContentNameLabel = "k8s.thalassa.cloud/volumesnapshotcontent-name"
+)
+
+// createMetadataPlaceholders maps the placeholders that can be used in
+// metadata templates to the parameter key holding their value.
+var createMetadataPlaceholders = map[string]string{
+	"pvc.name":                   pvcNameKey,
+	"pvc.namespace":              pvcNamespaceKey,
+	"pv.name":                    pvNameKey,
+	"volumesnapshot.name":        volumeSnapshotNameKey,
+	"volumesnapshot.namespace":   volumeSnapshotNamespaceKey,
+	"volumesnapshotcontent.name": volumeSnapshotContentNameKey,
+}
+
+// createMetadataLabelKeys maps the labels that link a Thalassa resource to
+// its Kubernetes objects to the parameter key holding their value.
+var createMetadataLabelKeys = map[string]string{
+	pvcNameLabel:                   pvcNameKey,
+	pvcNamespaceLabel:              pvcNamespaceKey,
+	pvNameLabel:                    pvNameKey,
+	volumeSnapshotNameLabel:        volumeSnapshotNameKey,
+	volumeSnapshotNamespaceLabel:   volumeSnapshotNamespaceKey,
+	volumeSnapshotContentNameLabel: volumeSnapshotContentNameKey,
+}
+
+// parseKeyValueParameter parses a comma separated list of key=value pairs,
+// e.g. "team=storage,env=prod".
+func parseKeyValueParameter(value string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", pair)
+		}
+		result[k] = strings.TrimSpace(v)
+	}
+	return result, nil
+}
+
+// expandMetadataTemplate replaces placeholders such as ${pvc.name} or
+// ${volumesnapshot.namespace} in the given template with the values from the
+// extra create metadata passed in the parameters.
+func expandMetadataTemplate(template string, params map[string]string) (string, error) {
+	var errs []string
+	expanded := os.Expand(template, func(placeholder string) string {
+		key, ok := createMetadataPlaceholders[placeholder]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown placeholder ${%s}", placeholder))
+			return ""
+		}
+		value, ok := params[key]
+		if !ok || value == "" {
+			errs = append(errs, fmt.Sprintf("placeholder ${%s} requires %q, enable --extra-create-metadata on the provisioner", placeholder, key))
+			return ""
+		}
+		return value
+	})
+	if len(errs) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return expanded, nil
+}
+
+// parseMetadataParameter parses a key=value list parameter and expands the
+// templates in its values.
+func parseMetadataParameter(name string, params map[string]string) (map[string]string, error) {
+	value, ok := params[name]
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	parsed, err := parseKeyValueParameter(value)
+	if err != nil {
+		return nil, fmt.Errorf("parameter %q: %w", name, err)
+	}
+
+	keys := make([]string, 0, len(parsed))
+	for k := range parsed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		expanded, err := expandMetadataTemplate(parsed[k], params)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q key %q: %w", name, k, err)
+		}
+		parsed[k] = expanded
+	}
+	return parsed, nil
+}
+
+// createMetadataLabels returns the labels that link a volume or snapshot to
+// the Kubernetes objects it was provisioned for.
+func createMetadataLabels(params map[string]string) map[string]string {
+	labels := make(map[string]string)
+	for label, key := range createMetadataLabelKeys {
+		if v := params[key]; v != "" {
+			labels[label] = v
+		}
+	}
+	return labels
+}
+
+// mergeMissing copies the entries from src into dst that are not yet set in
+// dst.
+func mergeMissing[M ~map[string]string](dst M, src map[string]string) {
+	for k, v := range src {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+	"github.com/thalassa-cloud/client-go/iaas"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseKeyValueParameter(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "single pair",
+			value: "team=storage",
+			want:  map[string]string{"team": "storage"},
+		},
+		{
+			name:  "multiple pairs with whitespace",
+			value: " team = storage , env=prod,",
+			want:  map[string]string{"team": "storage", "env": "prod"},
+		},
+		{
+			name:  "empty value",
+			value: "team=",
+			want:  map[string]string{"team": ""},
+		},
+		{
+			name:    "missing separator",
+			value:   "team",
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			value:   "=storage",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseKeyValueParameter(tt.value)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExpandMetadataTemplate(t *testing.T) {
+	params := map[string]string{
+		pvcNameKey:      "data",
+		pvcNamespaceKey: "default",
+		pvNameKey:       "pvc-1234",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		params   map[string]string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "no placeholders",
+			template: "static",
+			params:   params,
+			want:     "static",
+		},
+		{
+			name:     "all placeholders",
+			template: "${pvc.namespace}/${pvc.name} (${pv.name})",
+			params:   params,
+			want:     "default/data (pvc-1234)",
+		},
+		{
+			name:     "unknown placeholder",
+			template: "${pvc.uid}",
+			params:   params,
+			wantErr:  "unknown placeholder ${pvc.uid}",
+		},
+		{
+			name:     "missing extra create metadata",
+			template: "${pvc.name}",
+			params:   map[string]string{},
+			wantErr:  `placeholder ${pvc.name} requires "csi.storage.k8s.io/pvc/name", enable --extra-create-metadata on the provisioner`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandMetadataTemplate(tt.template, tt.params)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBuildCreateVolumeRequest(t *testing.T) {
+	tests := []struct {
+		name            string
+		params          map[string]string
+		customLabels    map[string]string
+		wantName        string
+		wantDescription string
+		wantLabels      map[string]string
+		wantAnnotations map[string]string
+		wantErr         error
+	}{
+		{
+			name:            "defaults",
+			wantName:        "pvc-1234",
+			wantDescription: createdByThalassaCSI,
+			wantLabels: map[string]string{
+				"k8s.thalassa.cloud/csi-driver":       "true",
+				"k8s.thalassa.cloud/csi-driver-name":  "csi.k8s.thalassa.cloud",
+				csiVolumeNameLabel:                    "pvc-1234",
+				"k8s.thalassa.cloud/cluster-identity": "k8s-1",
+			},
+			wantAnnotations: map[string]string{
+				"k8s.thalassa.cloud/description": "Provisioned by Thalassa CSI driver",
+			},
+		},
+		{
+			name: "storage class metadata with templates",
+			params: map[string]string{
+				pvcNameKey:           "data",
+				pvcNamespaceKey:      "default",
+				pvNameKey:            "pvc-1234",
+				labelsParameter:      "team=storage,app=${pvc.name}",
+				annotationsParameter: "owner=${pvc.namespace}",
+				descriptionParameter: "${pvc.namespace}/${pvc.name}",
+				volumeNameParameter:  "${pvc.namespace}-${pvc.name}",
+			},
+			customLabels:    map[string]string{"team": "global", "env": "prod"},
+			wantName:        "default-data",
+			wantDescription: "default/data",
+			wantLabels: map[string]string{
+				"k8s.thalassa.cloud/csi-driver":       "true",
+				"k8s.thalassa.cloud/csi-driver-name":  "csi.k8s.thalassa.cloud",
+				csiVolumeNameLabel:                    "pvc-1234",
+				"k8s.thalassa.cloud/cluster-identity": "k8s-1",
+				pvcNameLabel:                          "data",
+				pvcNamespaceLabel:                     "default",
+				pvNameLabel:                           "pvc-1234",
+				"team":                                "storage",
+				"app":                                 "data",
+				"env":                                 "prod",
+			},
+			wantAnnotations: map[string]string{
+				"k8s.thalassa.cloud/description": "Provisioned by Thalassa CSI driver",
+				"owner":                          "default",
+			},
+		},
+		{
+			name: "storage class labels cannot override driver labels",
+			params: map[string]string{
+				labelsParameter: "k8s.thalassa.cloud/csi-driver=false",
+			},
+			wantName:        "pvc-1234",
+			wantDescription: createdByThalassaCSI,
+			wantLabels: map[string]string{
+				"k8s.thalassa.cloud/csi-driver":       "true",
+				"k8s.thalassa.cloud/csi-driver-name":  "csi.k8s.thalassa.cloud",
+				csiVolumeNameLabel:                    "pvc-1234",
+				"k8s.thalassa.cloud/cluster-identity": "k8s-1",
+			},
+			wantAnnotations: map[string]string{
+				"k8s.thalassa.cloud/description": "Provisioned by Thalassa CSI driver",
+			},
+		},
+		{
+			name: "invalid labels",
+			params: map[string]string{
+				labelsParameter: "team",
+			},
+			wantErr: status.Error(codes.InvalidArgument, `invalid volume labels: parameter "labels": invalid key=value pair "team"`),
+		},
+		{
+			name: "template without extra create metadata",
+			params: map[string]string{
+				descriptionParameter: "${pvc.name}",
+			},
+			wantErr: status.Error(codes.InvalidArgument, `invalid volume description: placeholder ${pvc.name} requires "csi.storage.k8s.io/pvc/name", enable --extra-create-metadata on the provisioner`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Driver{
+				name:            "csi.k8s.thalassa.cloud",
+				region:          "nl-01",
+				clusterIdentity: "k8s-1",
+				CustomLabels:    tt.customLabels,
+			}
+			req := &csi.CreateVolumeRequest{
+				Name:       "pvc-1234",
+				Parameters: tt.params,
+			}
+
+			got, err := d.buildCreateVolumeRequest(req, req.Name, 10*giB, "vt-1")
+			if tt.wantErr != nil {
+				require.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantName, got.Name)
+			require.Equal(t, tt.wantDescription, got.Description)
+			require.Equal(t, iaas.Labels(tt.wantLabels), got.Labels)
+			require.Equal(t, iaas.Annotations(tt.wantAnnotations), got.Annotations)
+			require.Equal(t, 10, got.Size)
+			require.Equal(t, "vt-1", got.VolumeTypeIdentity)
+		})
+	}
+}
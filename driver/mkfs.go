@@ -0,0 +1,237 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+const (
+	// StorageClass parameters to tune the filesystem created on the volume.
+	// They are passed to the node via the volume context.
+	ext4BlockSizeParameter  = "ext4-block-size"
+	inodeSizeParameter      = "inode-size"
+	bytesPerInodeParameter  = "bytes-per-inode"
+	numberOfInodesParameter = "number-of-inodes"
+	xfsReflinkParameter     = "xfs-reflink"
+	fsLabelParameter        = "fs-label"
+	mkfsOptionsParameter    = "mkfs-options"
+
+	// forceFormatParameter allows formatting devices that contain a
+	// partition table, an LVM physical volume, a LUKS header or any other
+	// signature that is not a filesystem the driver can mount.
+	forceFormatParameter = "force-format"
+
+	defaultFsType = "ext4"
+
+	// maximum filesystem label lengths, see mke2fs(8), mkfs.xfs(8) and
+	// mkfs.btrfs(8)
+	maxExtLabelLength   = 16
+	maxXfsLabelLength   = 12
+	maxBtrfsLabelLength = 255
+)
+
+// annsForceFormatVolume can be added to the volume attributes of a PV to
+// allow formatting a device with foreign signatures, e.g. for static volumes.
+var annsForceFormatVolume = []string{
+	"csi.k8s.thalassa.cloud/force-format",
+}
+
+// forceFormatOption returns whether devices with foreign signatures may be
+// formatted, either by the StorageClass parameter or by the volume
+// annotation.
+func forceFormatOption(volumeContext map[string]string) (bool, error) {
+	return boolParameter(volumeContext, append([]string{forceFormatParameter}, annsForceFormatVolume...))
+}
+
+// supportedFsTypes lists the filesystems the node can format, mount and
+// expand.
+var supportedFsTypes = []string{"ext3", "ext4", "xfs", "btrfs"}
+
+// validateFsType checks whether the filesystem type is supported.
+func validateFsType(fsType string) error {
+	if slices.Contains(supportedFsTypes, fsType) {
+		return nil
+	}
+	return fmt.Errorf("unsupported fs type %q, supported fs types are: %s", fsType, strings.Join(supportedFsTypes, ", "))
+}
+
+// validateFsTypes checks whether the filesystem types requested by the mount
+// capabilities and the fstype parameter are supported.
+func validateFsTypes(caps []*csi.VolumeCapability, params map[string]string) error {
+	if fsType := params["fstype"]; fsType != "" {
+		if err := validateFsType(fsType); err != nil {
+			return err
+		}
+	}
+	for _, cap := range caps {
+		if fsType := cap.GetMount().GetFsType(); fsType != "" {
+			if err := validateFsType(fsType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mkfsParameters lists the parameters that are passed from CreateVolume to
+// NodeStageVolume via the volume context.
+var mkfsParameters = []string{
+	ext4BlockSizeParameter,
+	inodeSizeParameter,
+	bytesPerInodeParameter,
+	numberOfInodesParameter,
+	xfsReflinkParameter,
+	fsLabelParameter,
+	mkfsOptionsParameter,
+}
+
+// mkfsVolumeContext returns the mkfs parameters from the storage class
+// parameters that need to be stored in the volume context.
+func mkfsVolumeContext(params map[string]string) map[string]string {
+	volumeContext := make(map[string]string)
+	for _, p := range mkfsParameters {
+		if v, ok := params[p]; ok && v != "" {
+			volumeContext[p] = v
+		}
+	}
+	return volumeContext
+}
+
+// fsTypeFromCapabilities returns the filesystem type requested by the mount
+// capabilities, falling back to the fstype parameter and the default.
+func fsTypeFromCapabilities(caps []*csi.VolumeCapability, params map[string]string) string {
+	for _, cap := range caps {
+		if fsType := cap.GetMount().GetFsType(); fsType != "" {
+			return fsType
+		}
+	}
+	if fsType := params["fstype"]; fsType != "" {
+		return fsType
+	}
+	return defaultFsType
+}
+
+// mkfsArgsFromParameters validates the mkfs parameters for the given
+// filesystem type and converts them to mkfs arguments.
+func mkfsArgsFromParameters(fsType string, params map[string]string) ([]string, error) {
+	isExt := fsType == "ext3" || fsType == "ext4"
+	isXfs := fsType == "xfs"
+	isBtrfs := fsType == "btrfs"
+
+	var args []string
+	requireFs := func(param string, supported bool, fsTypes string) error {
+		if !supported {
+			return fmt.Errorf("parameter %q is only supported for %s, not %q", param, fsTypes, fsType)
+		}
+		return nil
+	}
+
+	if v := params[ext4BlockSizeParameter]; v != "" {
+		if err := requireFs(ext4BlockSizeParameter, isExt, "ext3 and ext4"); err != nil {
+			return nil, err
+		}
+		if v != "1024" && v != "2048" && v != "4096" {
+			return nil, fmt.Errorf("parameter %q must be one of 1024, 2048 or 4096, got %q", ext4BlockSizeParameter, v)
+		}
+		args = append(args, "-b", v)
+	}
+
+	if v := params[inodeSizeParameter]; v != "" {
+		if err := requireFs(inodeSizeParameter, isExt || isXfs, "ext3, ext4 and xfs"); err != nil {
+			return nil, err
+		}
+		minSize, maxSize := 128, 4096
+		if isXfs {
+			minSize, maxSize = 256, 2048
+		}
+		size, err := strconv.Atoi(v)
+		if err != nil || size < minSize || size > maxSize || size&(size-1) != 0 {
+			return nil, fmt.Errorf("parameter %q must be a power of two between %d and %d, got %q", inodeSizeParameter, minSize, maxSize, v)
+		}
+		if isXfs {
+			args = append(args, "-i", "size="+v)
+		} else {
+			args = append(args, "-I", v)
+		}
+	}
+
+	if v := params[bytesPerInodeParameter]; v != "" {
+		if err := requireFs(bytesPerInodeParameter, isExt, "ext3 and ext4"); err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1024 || n > 64*miB {
+			return nil, fmt.Errorf("parameter %q must be a number between 1024 and %d, got %q", bytesPerInodeParameter, 64*miB, v)
+		}
+		args = append(args, "-i", v)
+	}
+
+	if v := params[numberOfInodesParameter]; v != "" {
+		if err := requireFs(numberOfInodesParameter, isExt, "ext3 and ext4"); err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("parameter %q must be a positive number, got %q", numberOfInodesParameter, v)
+		}
+		args = append(args, "-N", v)
+	}
+
+	if v := params[xfsReflinkParameter]; v != "" {
+		if err := requireFs(xfsReflinkParameter, isXfs, "xfs"); err != nil {
+			return nil, err
+		}
+		reflink, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q must be a boolean, got %q", xfsReflinkParameter, v)
+		}
+		if reflink {
+			args = append(args, "-m", "reflink=1")
+		} else {
+			args = append(args, "-m", "reflink=0")
+		}
+	}
+
+	if v := params[fsLabelParameter]; v != "" {
+		if err := requireFs(fsLabelParameter, isExt || isXfs || isBtrfs, "ext3, ext4, xfs and btrfs"); err != nil {
+			return nil, err
+		}
+		maxLength := maxExtLabelLength
+		switch {
+		case isXfs:
+			maxLength = maxXfsLabelLength
+		case isBtrfs:
+			maxLength = maxBtrfsLabelLength
+		}
+		if len(v) > maxLength || strings.ContainsAny(v, " \t\n") {
+			return nil, fmt.Errorf("parameter %q must be at most %d characters without whitespace for %s, got %q", fsLabelParameter, maxLength, fsType, v)
+		}
+		args = append(args, "-L", v)
+	}
+
+	if v := params[mkfsOptionsParameter]; v != "" {
+		args = append(args, strings.Fields(v)...)
+	}
+
+	return args, nil
+}
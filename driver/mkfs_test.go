@@ -0,0 +1,277 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMkfsArgsFromParameters(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsType  string
+		params  map[string]string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "no parameters",
+			fsType: "ext4",
+			params: map[string]string{},
+		},
+		{
+			name:   "ext4 tuning for many small files",
+			fsType: "ext4",
+			params: map[string]string{
+				ext4BlockSizeParameter:  "1024",
+				inodeSizeParameter:      "256",
+				bytesPerInodeParameter:  "4096",
+				numberOfInodesParameter: "10000000",
+				fsLabelParameter:        "data",
+			},
+			want: []string{"-b", "1024", "-I", "256", "-i", "4096", "-N", "10000000", "-L", "data"},
+		},
+		{
+			name:   "xfs options",
+			fsType: "xfs",
+			params: map[string]string{
+				inodeSizeParameter:  "512",
+				xfsReflinkParameter: "false",
+				fsLabelParameter:    "data",
+			},
+			want: []string{"-i", "size=512", "-m", "reflink=0", "-L", "data"},
+		},
+		{
+			name:   "btrfs label",
+			fsType: "btrfs",
+			params: map[string]string{
+				fsLabelParameter: "a-very-long-label",
+			},
+			want: []string{"-L", "a-very-long-label"},
+		},
+		{
+			name:   "mkfs options escape hatch",
+			fsType: "ext4",
+			params: map[string]string{
+				mkfsOptionsParameter: "-O ^has_journal  -E lazy_itable_init=0",
+			},
+			want: []string{"-O", "^has_journal", "-E", "lazy_itable_init=0"},
+		},
+		{
+			name:   "invalid ext4 block size",
+			fsType: "ext4",
+			params: map[string]string{
+				ext4BlockSizeParameter: "8192",
+			},
+			wantErr: `parameter "ext4-block-size" must be one of 1024, 2048 or 4096, got "8192"`,
+		},
+		{
+			name:   "ext4 block size on xfs",
+			fsType: "xfs",
+			params: map[string]string{
+				ext4BlockSizeParameter: "4096",
+			},
+			wantErr: `parameter "ext4-block-size" is only supported for ext3 and ext4, not "xfs"`,
+		},
+		{
+			name:   "inode size not a power of two",
+			fsType: "ext4",
+			params: map[string]string{
+				inodeSizeParameter: "300",
+			},
+			wantErr: `parameter "inode-size" must be a power of two between 128 and 4096, got "300"`,
+		},
+		{
+			name:   "xfs inode size too small",
+			fsType: "xfs",
+			params: map[string]string{
+				inodeSizeParameter: "128",
+			},
+			wantErr: `parameter "inode-size" must be a power of two between 256 and 2048, got "128"`,
+		},
+		{
+			name:   "invalid number of inodes",
+			fsType: "ext4",
+			params: map[string]string{
+				numberOfInodesParameter: "-1",
+			},
+			wantErr: `parameter "number-of-inodes" must be a positive number, got "-1"`,
+		},
+		{
+			name:   "xfs reflink on ext4",
+			fsType: "ext4",
+			params: map[string]string{
+				xfsReflinkParameter: "true",
+			},
+			wantErr: `parameter "xfs-reflink" is only supported for xfs, not "ext4"`,
+		},
+		{
+			name:   "xfs label too long",
+			fsType: "xfs",
+			params: map[string]string{
+				fsLabelParameter: "a-very-long-label",
+			},
+			wantErr: `parameter "fs-label" must be at most 12 characters without whitespace for xfs, got "a-very-long-label"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mkfsArgsFromParameters(tt.fsType, tt.params)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCreateVolumeContext(t *testing.T) {
+	mountCap := func(fsType string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{FsType: fsType},
+			},
+		}
+	}
+
+	t.Run("keeps only mkfs parameters", func(t *testing.T) {
+		got, err := createVolumeContext(&csi.CreateVolumeRequest{
+			Parameters: map[string]string{
+				"volume-type":          "block",
+				bytesPerInodeParameter: "4096",
+			},
+			VolumeCapabilities: []*csi.VolumeCapability{mountCap("ext4")},
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{bytesPerInodeParameter: "4096"}, got)
+	})
+
+	t.Run("rejects parameters for the requested fs type", func(t *testing.T) {
+		_, err := createVolumeContext(&csi.CreateVolumeRequest{
+			Parameters: map[string]string{
+				bytesPerInodeParameter: "4096",
+			},
+			VolumeCapabilities: []*csi.VolumeCapability{mountCap("xfs")},
+		})
+		require.EqualError(t, err, `rpc error: code = InvalidArgument desc = invalid filesystem parameters: parameter "bytes-per-inode" is only supported for ext3 and ext4, not "xfs"`)
+	})
+
+	t.Run("keeps filesystem check parameters and the PVC", func(t *testing.T) {
+		got, err := createVolumeContext(&csi.CreateVolumeRequest{
+			Parameters: map[string]string{
+				fsRepairParameter: "true",
+				pvcNameKey:        "data",
+				pvcNamespaceKey:   "default",
+				pvNameKey:         "pvc-1234",
+			},
+			VolumeCapabilities: []*csi.VolumeCapability{mountCap("xfs")},
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			fsRepairParameter: "true",
+			pvcNameKey:        "data",
+			pvcNamespaceKey:   "default",
+		}, got)
+	})
+
+	t.Run("rejects repair for btrfs", func(t *testing.T) {
+		_, err := createVolumeContext(&csi.CreateVolumeRequest{
+			Parameters: map[string]string{
+				fsRepairParameter: "true",
+			},
+			VolumeCapabilities: []*csi.VolumeCapability{mountCap("btrfs")},
+		})
+		require.EqualError(t, err, `rpc error: code = InvalidArgument desc = invalid filesystem check parameters: repairing btrfs filesystems is not supported`)
+	})
+
+	t.Run("keeps the force format parameter", func(t *testing.T) {
+		got, err := createVolumeContext(&csi.CreateVolumeRequest{
+			Parameters: map[string]string{
+				forceFormatParameter: "true",
+			},
+			VolumeCapabilities: []*csi.VolumeCapability{mountCap("ext4")},
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{forceFormatParameter: "true"}, got)
+	})
+
+	t.Run("rejects an invalid force format parameter", func(t *testing.T) {
+		_, err := createVolumeContext(&csi.CreateVolumeRequest{
+			Parameters: map[string]string{
+				forceFormatParameter: "yes please",
+			},
+			VolumeCapabilities: []*csi.VolumeCapability{mountCap("ext4")},
+		})
+		require.EqualError(t, err, `rpc error: code = InvalidArgument desc = invalid filesystem parameters: parameter "force-format" must be a boolean, got "yes please"`)
+	})
+
+	t.Run("no mkfs parameters", func(t *testing.T) {
+		got, err := createVolumeContext(&csi.CreateVolumeRequest{
+			Parameters:         map[string]string{"volume-type": "block"},
+			VolumeCapabilities: []*csi.VolumeCapability{mountCap("ext4")},
+		})
+		require.NoError(t, err)
+		require.Nil(t, got)
+	})
+}
+
+func TestValidateFsTypes(t *testing.T) {
+	mountCap := func(fsType string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{FsType: fsType},
+			},
+		}
+	}
+	blockCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{
+			Block: &csi.VolumeCapability_BlockVolume{},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		caps    []*csi.VolumeCapability
+		params  map[string]string
+		wantErr string
+	}{
+		{
+			name: "default fs type",
+			caps: []*csi.VolumeCapability{mountCap("")},
+		},
+		{
+			name: "btrfs",
+			caps: []*csi.VolumeCapability{mountCap("btrfs")},
+		},
+		{
+			name: "block volume",
+			caps: []*csi.VolumeCapability{blockCap},
+		},
+		{
+			name:    "typo in capability fs type",
+			caps:    []*csi.VolumeCapability{mountCap("ext5")},
+			wantErr: `unsupported fs type "ext5", supported fs types are: ext3, ext4, xfs, btrfs`,
+		},
+		{
+			name:    "typo in fstype parameter",
+			caps:    []*csi.VolumeCapability{mountCap("")},
+			params:  map[string]string{"fstype": "zfs"},
+			wantErr: `unsupported fs type "zfs", supported fs types are: ext3, ext4, xfs, btrfs`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFsTypes(tt.caps, tt.params)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package driver
 
 import (
+	"context"
+
 	"k8s.io/mount-utils"
 )
 
@@ -38,19 +40,63 @@ type MockMounter struct {
 	UnmountErrors map[string]error
 	// FormatErrors allows injecting errors for format operations
 	FormatErrors map[string]error
+	// Devices maps volume IDs to device paths, defaults to the QEMU by-id path
+	Devices map[string]string
+	// DeviceErrors allows injecting errors for device lookups
+	DeviceErrors map[string]error
+	// DeviceSerials tracks the serials of devices
+	DeviceSerials map[string]string
+	// CheckResults allows injecting results for filesystem checks
+	CheckResults map[string]fsckResult
+	// CheckedDevices tracks checked devices and whether they were repaired
+	CheckedDevices map[string]bool
+	// PartitionTables tracks the partition tables of devices
+	PartitionTables map[string]string
+	// WipedDevices tracks wiped devices
+	WipedDevices map[string]bool
+	// Partitions maps devices to the partition used with auto, defaults to
+	// the device itself
+	Partitions map[string]string
+	// GrownPartitions tracks grown partitions
+	GrownPartitions map[string]bool
+	// MountOptions tracks the options targets are mounted with
+	MountOptions map[string][]string
+	// Health allows injecting the health of mounted volumes
+	Health map[string]volumeHealth
+	// DeviceSizes maps devices to the size of their disk after a rescan
+	DeviceSizes map[string]int64
+	// RescannedDevices tracks rescanned devices
+	RescannedDevices map[string]bool
+	// BlockDeviceErrors allows injecting errors for the device lookups of
+	// block volume targets
+	BlockDeviceErrors map[string]error
 }
 
 // NewMockMounter creates a new MockMounter
 func NewMockMounter() *MockMounter {
 	return &MockMounter{
-		MountPoints:      make(map[string]string),
-		FormattedDevices: make(map[string]string),
-		AttachedDevices:  make(map[string]bool),
-		Statistics:       make(map[string]volumeStatistics),
-		BlockDevices:     make(map[string]bool),
-		MountErrors:      make(map[string]error),
-		UnmountErrors:    make(map[string]error),
-		FormatErrors:     make(map[string]error),
+		MountPoints:       make(map[string]string),
+		FormattedDevices:  make(map[string]string),
+		AttachedDevices:   make(map[string]bool),
+		Statistics:        make(map[string]volumeStatistics),
+		BlockDevices:      make(map[string]bool),
+		MountErrors:       make(map[string]error),
+		UnmountErrors:     make(map[string]error),
+		FormatErrors:      make(map[string]error),
+		Devices:           make(map[string]string),
+		DeviceErrors:      make(map[string]error),
+		DeviceSerials:     make(map[string]string),
+		CheckResults:      make(map[string]fsckResult),
+		CheckedDevices:    make(map[string]bool),
+		PartitionTables:   make(map[string]string),
+		WipedDevices:      make(map[string]bool),
+		Partitions:        make(map[string]string),
+		GrownPartitions:   make(map[string]bool),
+		MountOptions:      make(map[string][]string),
+		Health:            make(map[string]volumeHealth),
+		DeviceSizes:       make(map[string]int64),
+		RescannedDevices:  make(map[string]bool),
+		BlockDeviceErrors: make(map[string]error),
 	}
 }
 
@@ -59,11 +105,45 @@ func (m *MockMounter) GetKMounter() mount.Interface {
 }
 
 // GetDeviceByID implements DeviceManager
-func (m *MockMounter) GetDeviceByID(volumeID string) (string, error) {
-	if device, ok := m.MountPoints[volumeID]; ok {
+func (m *MockMounter) GetDeviceByID(ctx context.Context, volumeID string, hints deviceHints) (string, error) {
+	if err := m.DeviceErrors[volumeID]; err != nil {
+		return "", err
+	}
+	if device, ok := m.Devices[volumeID]; ok {
 		return device, nil
 	}
-	return "", ErrDeviceNotFound
+	return getDeviceByIDPath(volumeID), nil
+}
+
+// VerifyDeviceSerial implements DeviceManager
+func (m *MockMounter) VerifyDeviceSerial(devicePath string, hints deviceHints) error {
+	if serial, ok := m.DeviceSerials[devicePath]; ok && hints.Serial != "" && serial != hints.Serial {
+		return ErrDeviceSerialMismatch
+	}
+	return nil
+}
+
+// GetPartition implements DeviceManager
+func (m *MockMounter) GetPartition(devicePath string, partition string) (string, error) {
+	if partition != partitionAuto {
+		return devicePath + "-part" + partition, nil
+	}
+	if p, ok := m.Partitions[devicePath]; ok {
+		return p, nil
+	}
+	return devicePath, nil
+}
+
+// GrowPartition implements DeviceManager
+func (m *MockMounter) GrowPartition(devicePath string) error {
+	m.GrownPartitions[devicePath] = true
+	return nil
+}
+
+// RescanDevice implements DeviceManager
+func (m *MockMounter) RescanDevice(devicePath string) (int64, error) {
+	m.RescannedDevices[devicePath] = true
+	return m.DeviceSizes[devicePath], nil
 }
 
 // IsDeviceAttached implements DeviceManager
@@ -75,7 +155,7 @@ func (m *MockMounter) IsDeviceAttached(devicePath string) error {
 }
 
 // Format implements FilesystemManager
-func (m *MockMounter) Format(devicePath, fsType string) error {
+func (m *MockMounter) Format(devicePath, fsType string, options ...string) error {
 	if err := m.FormatErrors[devicePath]; err != nil {
 		return err
 	}
@@ -97,6 +177,31 @@ func (m *MockMounter) IsFormatted(devicePath string) (bool, error) {
 	return ok, nil
 }
 
+// Probe implements FilesystemManager
+func (m *MockMounter) Probe(devicePath string) (deviceSignature, error) {
+	return deviceSignature{
+		Type:           m.FormattedDevices[devicePath],
+		PartitionTable: m.PartitionTables[devicePath],
+	}, nil
+}
+
+// Wipe implements FilesystemManager
+func (m *MockMounter) Wipe(devicePath string) error {
+	m.WipedDevices[devicePath] = true
+	delete(m.FormattedDevices, devicePath)
+	delete(m.PartitionTables, devicePath)
+	return nil
+}
+
+// Check implements FilesystemManager
+func (m *MockMounter) Check(devicePath, fsType string, repair bool) (fsckResult, error) {
+	m.CheckedDevices[devicePath] = repair
+	if result, ok := m.CheckResults[devicePath]; ok {
+		return result, nil
+	}
+	return fsckResult{Status: fsckClean}, nil
+}
+
 // Resize implements FilesystemManager
 func (m *MockMounter) Resize(devicePath, mountPath string) error {
 	return nil
@@ -108,6 +213,7 @@ func (m *MockMounter) Mount(source, target, fsType string, options ...string) er
 		return err
 	}
 	m.MountPoints[target] = source
+	m.MountOptions[target] = options
 	return nil
 }
 
@@ -146,3 +252,19 @@ func (m *MockMounter) GetStatistics(volumePath string) (volumeStatistics, error)
 func (m *MockMounter) IsBlockDevice(volumePath string) (bool, error) {
 	return m.BlockDevices[volumePath], nil
 }
+
+// GetBlockDevice implements StatisticsManager
+func (m *MockMounter) GetBlockDevice(targetPath string) (string, error) {
+	if err := m.BlockDeviceErrors[targetPath]; err != nil {
+		return "", err
+	}
+	if device, ok := m.MountPoints[targetPath]; ok {
+		return device, nil
+	}
+	return "", ErrDeviceNotFound
+}
+
+// GetVolumeHealth implements StatisticsManager
+func (m *MockMounter) GetVolumeHealth(volumePath, devicePath string) (volumeHealth, error) {
+	return m.Health[volumePath], nil
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package driver
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -24,9 +25,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"syscall"
+	"time"
+	"unsafe"
 
 	"golang.org/x/sys/unix"
 	"k8s.io/mount-utils"
@@ -75,18 +77,40 @@ const (
 
 // DeviceManager handles device-related operations
 type DeviceManager interface {
-	// GetDeviceByID returns the device path for a given volume ID
-	GetDeviceByID(volumeID string) (string, error)
+	// GetDeviceByID returns the device path for a given volume ID, using the
+	// hints from the publish context, waiting for it until the context is
+	// done
+	GetDeviceByID(ctx context.Context, volumeID string, hints deviceHints) (string, error)
 	// IsDeviceAttached checks if a device is properly attached
 	IsDeviceAttached(devicePath string) error
+	// VerifyDeviceSerial checks if the serial of a device matches the serial
+	// of the volume attachment
+	VerifyDeviceSerial(devicePath string, hints deviceHints) error
+	// GetPartition returns the device path of a partition of a device, or
+	// of its only partition with auto
+	GetPartition(devicePath string, partition string) (string, error)
+	// GrowPartition grows a partition to the end of its disk, devices that
+	// are not partitions are left as they are
+	GrowPartition(devicePath string) error
+	// RescanDevice rescans the disk of a device so the kernel sees its new
+	// size, and returns the size of the disk in bytes
+	RescanDevice(devicePath string) (int64, error)
 }
 
 // FilesystemManager handles filesystem operations
 type FilesystemManager interface {
-	// Format formats a device with the specified filesystem
-	Format(devicePath, fsType string) error
+	// Format formats a device with the specified filesystem and additional
+	// mkfs options
+	Format(devicePath, fsType string, options ...string) error
 	// IsFormatted checks if a device is already formatted
 	IsFormatted(devicePath string) (bool, error)
+	// Probe returns the filesystem, partition table or other signatures
+	// found on a device
+	Probe(devicePath string) (deviceSignature, error)
+	// Wipe erases all signatures from a device
+	Wipe(devicePath string) error
+	// Check checks, and optionally repairs, the filesystem on a device
+	Check(devicePath, fsType string, repair bool) (fsckResult, error)
 	// Resize resizes a filesystem
 	// Resize(devicePath, mountPath string) error
 }
@@ -113,37 +137,75 @@ type StatisticsManager interface {
 	GetStatistics(volumePath string) (volumeStatistics, error)
 	// IsBlockDevice checks if a path is a block device
 	IsBlockDevice(volumePath string) (bool, error)
+	// GetBlockDevice returns the device bind mounted to the target of a
+	// block volume
+	GetBlockDevice(targetPath string) (string, error)
+	// GetVolumeHealth checks the mount and device of a mounted volume,
+	// devicePath is the device of a block volume
+	GetVolumeHealth(volumePath, devicePath string) (volumeHealth, error)
 }
 
 // Mounter is responsible for formatting and mounting volumes
 type Mounter interface {
-	// DeviceManager
+	DeviceManager
 	FilesystemManager
 	MountManager
 	StatisticsManager
 }
 
 type mounter struct {
+	DeviceManager
+
 	log                 *slog.Logger
 	kMounter            *mount.SafeFormatAndMount
 	attachmentValidator AttachmentValidator
+	// mountInfoPath is the mount table to read, defaults to mountInfoPath
+	mountInfoPath string
+	// propagationMode defines how mounts without shared propagation are
+	// treated by IsMounted
+	propagationMode propagationMode
+	// kubeletDir is the kubelet root directory, used in remediation hints
+	kubeletDir string
+	// sysPath is where sysfs is mounted, defaults to defaultSysPath
+	sysPath string
+	// devPath is where the device nodes are, defaults to /dev
+	devPath string
+}
+
+// mounterOptions configure the mounter of the node plugin.
+type mounterOptions struct {
+	// propagationMode defines how mounts without shared propagation are
+	// treated by IsMounted
+	propagationMode propagationMode
+	// kubeletDir is the kubelet root directory, used in remediation hints
+	kubeletDir string
+	// deviceWaitTimeout and deviceWaitInterval define how long and how often
+	// to look for the device of an attached volume
+	deviceWaitTimeout  time.Duration
+	deviceWaitInterval time.Duration
 }
 
 // NewMounter returns a new mounter instance
-func NewMounter(log *slog.Logger) Mounter {
+func NewMounter(log *slog.Logger, opts mounterOptions) Mounter {
 	kMounter := &mount.SafeFormatAndMount{
 		Interface: mount.New(""),
 		Exec:      kexec.New(),
 	}
 
 	return &mounter{
+		DeviceManager:       newDeviceManager(log, opts.deviceWaitTimeout, opts.deviceWaitInterval),
 		kMounter:            kMounter,
 		log:                 log,
 		attachmentValidator: &prodAttachmentValidator{},
+		mountInfoPath:       mountInfoPath,
+		propagationMode:     opts.propagationMode,
+		kubeletDir:          opts.kubeletDir,
+		sysPath:             defaultSysPath,
+		devPath:             "/dev",
 	}
 }
 
-func (m *mounter) Format(source, fsType string) error {
+func (m *mounter) Format(source, fsType string, options ...string) error {
 	mkfsCmd := fmt.Sprintf("mkfs.%s", fsType)
 
 	_, err := exec.LookPath(mkfsCmd)
@@ -154,7 +216,7 @@ func (m *mounter) Format(source, fsType string) error {
 		return err
 	}
 
-	mkfsArgs := make([]string, 0, 1)
+	mkfsArgs := make([]string, 0, len(options)+2)
 
 	if fsType == "" {
 		return errors.New("fs type is not specified for formatting the volume")
@@ -164,10 +226,11 @@ func (m *mounter) Format(source, fsType string) error {
 		return errors.New("source is not specified for formatting the volume")
 	}
 
-	mkfsArgs = append(mkfsArgs, source)
 	if fsType == "ext4" || fsType == "ext3" {
-		mkfsArgs = []string{"-F", source}
+		mkfsArgs = append(mkfsArgs, "-F")
 	}
+	mkfsArgs = append(mkfsArgs, options...)
+	mkfsArgs = append(mkfsArgs, source)
 
 	m.log.Info("executing format command", "cmd", mkfsCmd, "args", mkfsArgs)
 	out, err := exec.Command(mkfsCmd, mkfsArgs...).CombinedOutput()
@@ -178,6 +241,46 @@ func (m *mounter) Format(source, fsType string) error {
 	return nil
 }
 
+func (m *mounter) Check(source, fsType string, repair bool) (fsckResult, error) {
+	if source == "" {
+		return fsckResult{}, errors.New("source is not specified for checking the filesystem")
+	}
+
+	fsckCmd, fsckArgs, err := fsckCommand(fsType, source, repair)
+	if err != nil {
+		return fsckResult{}, err
+	}
+
+	_, err = exec.LookPath(fsckCmd)
+	if err != nil {
+		if err == exec.ErrNotFound {
+			return fsckResult{}, fmt.Errorf("%q executable not found in $PATH", fsckCmd)
+		}
+		return fsckResult{}, err
+	}
+
+	m.log.Info("executing filesystem check command", "cmd", fsckCmd, "args", fsckArgs)
+
+	exitCode := 0
+	out, err := exec.Command(fsckCmd, fsckArgs...).CombinedOutput()
+	if err != nil {
+		exitError, ok := err.(*exec.ExitError)
+		if !ok {
+			return fsckResult{}, fmt.Errorf("checking filesystem failed: %v cmd: '%s %s'",
+				err, fsckCmd, strings.Join(fsckArgs, " "))
+		}
+		exitCode = exitError.ExitCode()
+	}
+
+	fsckStatus, err := fsckStatusFromExitCode(fsType, exitCode)
+	if err != nil {
+		return fsckResult{}, fmt.Errorf("checking filesystem failed: %v cmd: '%s %s' output: %q",
+			err, fsckCmd, strings.Join(fsckArgs, " "), string(out))
+	}
+
+	return fsckResult{Status: fsckStatus, Output: string(out)}, nil
+}
+
 func (m *mounter) Mount(source, target, fsType string, opts ...string) error {
 	mountCmd := "mount"
 	mountArgs := []string{}
@@ -275,40 +378,109 @@ func (m *mounter) IsAttached(source string) error {
 }
 
 func (m *mounter) IsFormatted(source string) (bool, error) {
+	signature, err := m.Probe(source)
+	if err != nil {
+		return false, err
+	}
+	return !signature.IsEmpty(), nil
+}
+
+func (m *mounter) Probe(source string) (deviceSignature, error) {
 	if source == "" {
-		return false, errors.New("source is not specified")
+		return deviceSignature{}, errors.New("source is not specified")
+	}
+
+	signature, err := probeDevice(source)
+	if err != nil {
+		m.log.Warn("probing the source for signatures failed, falling back to blkid", "source", source, "error", err)
+		return m.probeBlkid(source)
+	}
+	if !signature.IsEmpty() {
+		m.log.Info("found signatures on the source", "source", source, "fs_type", signature.Type, "partition_table", signature.PartitionTable)
+		return signature, nil
 	}
 
+	// signatures that are not probed natively, like swap or zfs, are only
+	// detected by blkid
+	if _, err := exec.LookPath("blkid"); err != nil {
+		m.log.Info("no signatures found on the source and blkid is not available", "source", source)
+		return deviceSignature{}, nil
+	}
+	return m.probeBlkid(source)
+}
+
+// probeBlkid looks up the signatures of the source with the low-level
+// probing of blkid, which bypasses the blkid cache.
+func (m *mounter) probeBlkid(source string) (deviceSignature, error) {
 	blkidCmd := "blkid"
 	_, err := exec.LookPath(blkidCmd)
 	if err != nil {
 		if err == exec.ErrNotFound {
-			return false, fmt.Errorf("%q executable not found in $PATH", blkidCmd)
+			return deviceSignature{}, fmt.Errorf("%q executable not found in $PATH", blkidCmd)
 		}
-		return false, err
+		return deviceSignature{}, err
 	}
 
-	blkidArgs := []string{source}
+	blkidArgs := []string{"-p", "-o", "export", source}
 
 	m.log.Info("checking if source is formatted", "cmd", blkidCmd, "args", blkidArgs)
 
-	exitCode := 0
-	cmd := exec.Command(blkidCmd, blkidArgs...)
-	err = cmd.Run()
+	out, err := exec.Command(blkidCmd, blkidArgs...).Output()
 	if err != nil {
 		exitError, ok := err.(*exec.ExitError)
 		if !ok {
-			return false, fmt.Errorf("checking formatting failed: %v cmd: %q, args: %q", err, blkidCmd, blkidArgs)
+			return deviceSignature{}, fmt.Errorf("checking formatting failed: %v cmd: %q, args: %q", err, blkidCmd, blkidArgs)
 		}
 		ws := exitError.Sys().(syscall.WaitStatus)
-		exitCode = ws.ExitStatus()
-		if exitCode == blkidExitStatusNoIdentifiers {
-			return false, nil
+		if ws.ExitStatus() == blkidExitStatusNoIdentifiers {
+			return deviceSignature{}, nil
+		}
+		return deviceSignature{}, fmt.Errorf("checking formatting failed: %v cmd: %q, args: %q", err, blkidCmd, blkidArgs)
+	}
+
+	return parseBlkidExport(string(out)), nil
+}
+
+// parseBlkidExport parses the KEY=value output of `blkid -o export`.
+func parseBlkidExport(out string) deviceSignature {
+	var signature deviceSignature
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "TYPE":
+			signature.Type = value
+		case "PTTYPE":
+			signature.PartitionTable = value
 		}
-		return false, fmt.Errorf("checking formatting failed: %v cmd: %q, args: %q", err, blkidCmd, blkidArgs)
+	}
+	return signature
+}
+
+func (m *mounter) Wipe(source string) error {
+	if source == "" {
+		return errors.New("source is not specified for wiping the volume")
 	}
 
-	return true, nil
+	wipefsCmd := "wipefs"
+	if _, err := exec.LookPath(wipefsCmd); err != nil {
+		if err == exec.ErrNotFound {
+			return fmt.Errorf("%q executable not found in $PATH", wipefsCmd)
+		}
+		return err
+	}
+
+	wipefsArgs := []string{"--all", source}
+
+	m.log.Info("wiping the signatures of the source", "cmd", wipefsCmd, "args", wipefsArgs)
+	out, err := exec.Command(wipefsCmd, wipefsArgs...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("wiping disk failed: %v cmd: '%s %s' output: %q",
+			err, wipefsCmd, strings.Join(wipefsArgs, " "), string(out))
+	}
+	return nil
 }
 
 func (m *mounter) IsMounted(target string) (bool, error) {
@@ -316,6 +488,35 @@ func (m *mounter) IsMounted(target string) (bool, error) {
 		return false, errors.New("target is not specified for checking the mount")
 	}
 
+	path := m.mountInfoPath
+	if path == "" {
+		path = mountInfoPath
+	}
+
+	mounts, err := readMountInfo(path)
+	if err != nil {
+		m.log.Warn("reading the mount table failed, falling back to findmnt", "path", path, "error", err)
+		return m.isMountedFindmnt(target)
+	}
+
+	target = filepath.Clean(target)
+	var fileSystems []fileSystem
+	for _, mi := range mounts {
+		if mi.MountPoint == target {
+			fileSystems = append(fileSystems, fileSystem{
+				Target:      mi.MountPoint,
+				Propagation: mi.Propagation(),
+				FsType:      mi.FsType,
+				Options:     mi.MountOptions,
+			})
+		}
+	}
+
+	return m.isTargetMounted(target, fileSystems)
+}
+
+// isMountedFindmnt checks whether the target is mounted using findmnt.
+func (m *mounter) isMountedFindmnt(target string) (bool, error) {
 	findmntCmd := "findmnt"
 	_, err := exec.LookPath(findmntCmd)
 	if err != nil {
@@ -351,11 +552,30 @@ func (m *mounter) IsMounted(target string) (bool, error) {
 		return false, fmt.Errorf("couldn't unmarshal data: %q: %s", string(out), err)
 	}
 
+	return m.isTargetMounted(target, resp.FileSystems)
+}
+
+// isTargetMounted checks whether the target is one of the mounted
+// filesystems and whether their mount propagation is shared.
+func (m *mounter) isTargetMounted(target string, fileSystems []fileSystem) (bool, error) {
+	kubeletDir := m.kubeletDir
+	if kubeletDir == "" {
+		kubeletDir = defaultKubeletDir
+	}
+
 	targetFound := false
-	for _, fs := range resp.FileSystems {
+	for _, fs := range fileSystems {
 		// check if the mount is propagated correctly. It should be set to shared.
 		if fs.Propagation != "shared" {
-			return true, fmt.Errorf("mount propagation for target %q is not enabled", target)
+			switch m.propagationMode {
+			case propagationIgnore:
+			case propagationWarn:
+				m.log.Warn("mount propagation for target is not shared", "target", target, "propagation", fs.Propagation,
+					"remediation", propagationRemediation(kubeletDir))
+			default:
+				return true, fmt.Errorf("mount propagation for target %q is %q instead of shared: %s",
+					target, fs.Propagation, propagationRemediation(kubeletDir))
+			}
 		}
 
 		// the mountpoint should match as well
@@ -377,32 +597,37 @@ func (m *mounter) GetKMounter() mount.Interface {
 	return m.kMounter
 }
 
+// GetStatistics returns the statistics of a volume. The target of a block
+// volume is a device file, of which only the size is known, the target of a
+// filesystem volume is a directory.
 func (m *mounter) GetStatistics(volumePath string) (volumeStatistics, error) {
-	isBlock, err := m.IsBlockDevice(volumePath)
-	if err != nil {
-		return volumeStatistics{}, fmt.Errorf("failed to determine if volume %s is block device: %v", volumePath, err)
+	var stat unix.Stat_t
+	if err := unix.Stat(volumePath, &stat); err != nil {
+		return volumeStatistics{}, err
 	}
 
-	if isBlock {
-		// See http://man7.org/linux/man-pages/man8/blockdev.8.html for details
-		output, err := exec.Command("blockdev", "getsize64", volumePath).CombinedOutput()
-		if err != nil {
-			return volumeStatistics{}, fmt.Errorf("error when getting size of block volume at path %s: output: %s, err: %v", volumePath, string(output), err)
-		}
-		strOut := strings.TrimSpace(string(output))
-		gotSizeBytes, err := strconv.ParseInt(strOut, 10, 64)
+	switch stat.Mode & unix.S_IFMT {
+	case unix.S_IFBLK:
+		size, err := blockDeviceSize(volumePath)
 		if err != nil {
-			return volumeStatistics{}, fmt.Errorf("failed to parse size %s into int", strOut)
+			return volumeStatistics{}, err
 		}
-
 		return volumeStatistics{
-			totalBytes: gotSizeBytes,
+			totalBytes: size,
 		}, nil
+	case unix.S_IFDIR:
+		return filesystemStatistics(volumePath)
+	default:
+		return volumeStatistics{}, fmt.Errorf("volume path %q is neither a block device nor a directory", volumePath)
 	}
+}
 
+// filesystemStatistics returns the byte and inode usage of the filesystem
+// mounted at the path.
+func filesystemStatistics(volumePath string) (volumeStatistics, error) {
 	var statfs unix.Statfs_t
 	// See https://man7.org/linux/man-pages/man2/statfs.2.html for details.
-	err = unix.Statfs(volumePath, &statfs)
+	err := unix.Statfs(volumePath, &statfs)
 	if err != nil {
 		return volumeStatistics{}, err
 	}
@@ -420,6 +645,56 @@ func (m *mounter) GetStatistics(volumePath string) (volumeStatistics, error) {
 	return volStats, nil
 }
 
+// blockDeviceSize returns the size of the block device in bytes, as reported
+// by the BLKGETSIZE64 ioctl.
+func blockDeviceSize(devicePath string) (int64, error) {
+	f, err := os.Open(devicePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var size uint64
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), unix.BLKGETSIZE64, uintptr(unsafe.Pointer(&size))); errno != 0 {
+		return 0, fmt.Errorf("failed to get size of block device %q: %v", devicePath, errno)
+	}
+	return int64(size), nil
+}
+
+// GetBlockDevice returns the device that is bind mounted to the target of a
+// block volume. The device is resolved with the major:minor of the target in
+// /sys/dev/block, as the mount table only shows the devtmpfs it came from.
+func (m *mounter) GetBlockDevice(targetPath string) (string, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(targetPath, &stat); err != nil {
+		return "", err
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return "", fmt.Errorf("target %q is not a block device", targetPath)
+	}
+
+	rdev := uint64(stat.Rdev)
+	return m.deviceOfMajorMinor(fmt.Sprintf("%d:%d", unix.Major(rdev), unix.Minor(rdev)))
+}
+
+// deviceOfMajorMinor returns the path of the device with the major:minor, as
+// found in /sys/dev/block.
+func (m *mounter) deviceOfMajorMinor(majorMinor string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(filepath.Join(m.sysPath, "dev", "block", majorMinor))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("%w: no block device with major:minor %s", ErrDeviceNotFound, majorMinor)
+		}
+		return "", err
+	}
+
+	devPath := m.devPath
+	if devPath == "" {
+		devPath = "/dev"
+	}
+	return filepath.Join(devPath, filepath.Base(resolved)), nil
+}
+
 func (m *mounter) IsBlockDevice(devicePath string) (bool, error) {
 	var stat unix.Stat_t
 	err := unix.Stat(devicePath, &stat)
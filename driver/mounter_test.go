@@ -19,6 +19,7 @@ package driver
 import (
 	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -78,3 +79,51 @@ func TestMounterIsAttached(t *testing.T) {
 		})
 	}
 }
+
+func TestMounterGetStatistics(t *testing.T) {
+	m := &mounter{
+		log: slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	}
+
+	t.Run("filesystem volume", func(t *testing.T) {
+		stats, err := m.GetStatistics(t.TempDir())
+		require.NoError(t, err)
+		require.Positive(t, stats.totalBytes)
+		require.Positive(t, stats.totalInodes)
+	})
+
+	t.Run("neither a block device nor a directory", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "target")
+		require.NoError(t, os.WriteFile(file, nil, 0600))
+
+		_, err := m.GetStatistics(file)
+		require.EqualError(t, err, `volume path "`+file+`" is neither a block device nor a directory`)
+	})
+
+	t.Run("size of a file that is not a block device", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "target")
+		require.NoError(t, os.WriteFile(file, nil, 0600))
+
+		_, err := blockDeviceSize(file)
+		require.ErrorContains(t, err, "failed to get size of block device")
+	})
+}
+
+func TestMounterDeviceOfMajorMinor(t *testing.T) {
+	m := &mounter{
+		log:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		sysPath: testSysfs(t, runningState),
+		devPath: "/dev",
+	}
+
+	device, err := m.deviceOfMajorMinor("8:17")
+	require.NoError(t, err)
+	require.Equal(t, "/dev/sdb1", device)
+
+	_, err = m.deviceOfMajorMinor("8:32")
+	require.ErrorIs(t, err, ErrDeviceNotFound)
+
+	// the target of a filesystem volume is not a block device
+	_, err = m.GetBlockDevice(t.TempDir())
+	require.ErrorContains(t, err, "is not a block device")
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// mountInfoPath is the mount table of the plugin's mount namespace, see
+	// proc_pid_mountinfo(5)
+	mountInfoPath = "/proc/self/mountinfo"
+)
+
+// mountInfo is a single entry of the mount table.
+type mountInfo struct {
+	MountID      int
+	ParentID     int
+	MajorMinor   string
+	Root         string
+	MountPoint   string
+	MountOptions string
+	// OptionalFields holds the propagation fields, e.g. shared:1 or master:2
+	OptionalFields []string
+	FsType         string
+	Source         string
+	SuperOptions   string
+}
+
+// Propagation returns the propagation type of the mount in the same format
+// as findmnt, e.g. "shared", "private" or "shared,slave".
+func (mi mountInfo) Propagation() string {
+	var propagation []string
+	var shared, slave, unbindable bool
+	for _, field := range mi.OptionalFields {
+		switch tag, _, _ := strings.Cut(field, ":"); tag {
+		case "shared":
+			shared = true
+		case "master":
+			slave = true
+		case "unbindable":
+			unbindable = true
+		}
+	}
+	if shared {
+		propagation = append(propagation, "shared")
+	}
+	if slave {
+		propagation = append(propagation, "slave")
+	}
+	if unbindable {
+		propagation = append(propagation, "unbindable")
+	}
+	if len(propagation) == 0 {
+		return "private"
+	}
+	return strings.Join(propagation, ",")
+}
+
+// readMountInfo reads and parses the mount table from the given path.
+func readMountInfo(path string) ([]mountInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMountInfo(f)
+}
+
+// parseMountInfo parses a mount table in the format of
+// /proc/<pid>/mountinfo:
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfo(r io.Reader) ([]mountInfo, error) {
+	var mounts []mountInfo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		// the optional fields are terminated by a single hyphen
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if len(fields) < 10 || separator == -1 || len(fields) < separator+3 {
+			return nil, fmt.Errorf("invalid mountinfo line %q", line)
+		}
+
+		mountID, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid mount id in mountinfo line %q: %v", line, err)
+		}
+		parentID, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent id in mountinfo line %q: %v", line, err)
+		}
+
+		mi := mountInfo{
+			MountID:      mountID,
+			ParentID:     parentID,
+			MajorMinor:   fields[2],
+			Root:         unescapeMountInfo(fields[3]),
+			MountPoint:   unescapeMountInfo(fields[4]),
+			MountOptions: fields[5],
+			FsType:       fields[separator+1],
+			Source:       unescapeMountInfo(fields[separator+2]),
+		}
+		if separator > 6 {
+			mi.OptionalFields = fields[6:separator]
+		}
+		if len(fields) > separator+3 {
+			mi.SuperOptions = fields[separator+3]
+		}
+		mounts = append(mounts, mi)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// unescapeMountInfo replaces the octal escapes the kernel uses for space,
+// tab, newline and backslash in the mount table.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
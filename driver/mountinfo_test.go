@@ -0,0 +1,110 @@
+package driver
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := readMountInfo("testdata/mountinfo")
+	require.NoError(t, err)
+	require.Len(t, mounts, 9)
+
+	require.Equal(t, mountInfo{
+		MountID:        310,
+		ParentID:       120,
+		MajorMinor:     "8:16",
+		Root:           "/",
+		MountPoint:     "/var/lib/kubelet/plugins/kubernetes.io/csi/csi.k8s.thalassa.cloud/0123/globalmount",
+		MountOptions:   "rw,relatime",
+		OptionalFields: []string{"shared:180"},
+		FsType:         "ext4",
+		Source:         "/dev/sdb",
+		SuperOptions:   "rw",
+	}, mounts[5])
+
+	require.Equal(t, "shared", mounts[5].Propagation())
+	require.Equal(t, "private", mounts[7].Propagation())
+	require.Equal(t, "shared,slave", mounts[8].Propagation())
+	require.Equal(t, "/var/lib/kubelet/pods/pod-2/volumes/kubernetes.io~csi/pvc with space/mount", mounts[8].MountPoint)
+}
+
+func TestParseMountInfoInvalid(t *testing.T) {
+	_, err := parseMountInfo(strings.NewReader("22 1 252:1 / / rw,relatime shared:1 ext4 /dev/vda1 rw\n"))
+	require.EqualError(t, err, `invalid mountinfo line "22 1 252:1 / / rw,relatime shared:1 ext4 /dev/vda1 rw"`)
+}
+
+func TestUnescapeMountInfo(t *testing.T) {
+	require.Equal(t, "a b\tc\\d", unescapeMountInfo(`a\040b\011c\134d`))
+	require.Equal(t, `trailing\04`, unescapeMountInfo(`trailing\04`))
+}
+
+func TestMounterIsMounted(t *testing.T) {
+	privateTarget := "/var/lib/kubelet/plugins/kubernetes.io/csi/csi.k8s.thalassa.cloud/4567/globalmount"
+
+	tests := []struct {
+		name          string
+		target        string
+		mode          propagationMode
+		want          bool
+		expectedError string
+	}{
+		{
+			name:   "shared mount",
+			target: "/var/lib/kubelet/plugins/kubernetes.io/csi/csi.k8s.thalassa.cloud/0123/globalmount",
+			want:   true,
+		},
+		{
+			name:   "trailing slash",
+			target: "/var/lib/kubelet/pods/pod-1/volumes/kubernetes.io~csi/pvc-1/mount/",
+			want:   true,
+		},
+		{
+			name:   "not mounted",
+			target: "/var/lib/kubelet/pods/pod-3/volumes/kubernetes.io~csi/pvc-3/mount",
+			want:   false,
+		},
+		{
+			name:   "private mount",
+			target: privateTarget,
+			mode:   propagationStrict,
+			want:   true,
+			expectedError: `mount propagation for target "` + privateTarget + `" is "private" instead of shared: ` +
+				propagationRemediation("/var/lib/kubelet"),
+		},
+		{
+			name:   "private mount with warn mode",
+			target: privateTarget,
+			mode:   propagationWarn,
+			want:   true,
+		},
+		{
+			name:   "private mount with ignore mode",
+			target: privateTarget,
+			mode:   propagationIgnore,
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mounter{
+				log:             slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				mountInfoPath:   "testdata/mountinfo",
+				propagationMode: tt.mode,
+			}
+
+			got, err := m.IsMounted(tt.target)
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
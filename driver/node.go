@@ -18,6 +18,7 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -77,9 +78,6 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
-	source := getDeviceByIDPath(req.GetVolumeId())
-	target := req.StagingTargetPath
-
 	mnt := req.VolumeCapability.GetMount()
 	if mnt == nil {
 		return nil, status.Error(codes.InvalidArgument, "NodeStageVolume Volume Capability Mount must be provided")
@@ -87,18 +85,65 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 
 	options := mnt.MountFlags
 
-	fsType := "ext4"
+	fsType := defaultFsType
 	if mnt.FsType != "" {
 		fsType = mnt.FsType
 	}
 
+	if err := validateFsType(fsType); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "NodeStageVolume %v", err)
+	}
+
+	checkFs, repairFs, err := fsckOptions(req.VolumeContext)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "NodeStageVolume %v", err)
+	}
+	forceFormat, err := forceFormatOption(req.VolumeContext)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "NodeStageVolume %v", err)
+	}
+	partition, err := partitionOption(req.VolumeContext)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "NodeStageVolume %v", err)
+	}
+
+	// read only volumes are neither formatted, repaired nor resized, and
+	// their journal is not replayed, as that writes to the device
+	readOnly := isReadOnlyAccessMode(req.VolumeCapability.GetAccessMode())
+	if readOnly {
+		options = append(options, readOnlyMountOptions(fsType)...)
+		repairFs = false
+	}
+
+	hints := d.deviceHints(req.PublishContext)
+	source, err := d.mounter.GetDeviceByID(ctx, req.VolumeId, hints)
+	if err != nil {
+		// the device may still appear, let the CO retry
+		if errors.Is(err, ErrDeviceNotFound) {
+			return nil, status.Errorf(codes.Unavailable, "NodeStageVolume failed to find device of volume %q: %v", req.VolumeId, err)
+		}
+		return nil, status.Errorf(codes.Internal, "NodeStageVolume failed to find device of volume %q: %v", req.VolumeId, err)
+	}
+	// the attachment and serial are checked on the disk, the filesystem is
+	// on the partition when one is selected
+	disk := source
+	if partition != "" {
+		source, err = d.mounter.GetPartition(disk, partition)
+		if err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "NodeStageVolume failed to find partition %s of volume %q: %v", partition, req.VolumeId, err)
+		}
+	}
+	target := req.StagingTargetPath
+
 	log = d.log.With("volume_mode", volumeModeFilesystem,
 		"volume_name", req.GetVolumeId(),
 		"volume_context", req.VolumeContext,
 		"publish_context", req.PublishContext,
 		"source", source,
+		"partition", partition,
 		"fs_type", fsType,
 		"mount_options", options,
+		"readonly", readOnly,
 	)
 
 	var noFormat bool
@@ -112,23 +157,55 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 		log.Info("skipping formatting the source device")
 	} else {
 		if d.validateAttachment {
-			if err := d.mounter.IsAttached(source); err != nil {
-				return nil, status.Error(codes.Internal, fmt.Sprintf("error retrieving the attachement status %q: %s", source, err))
+			if err := d.mounter.IsAttached(disk); err != nil {
+				return nil, status.Error(codes.Internal, fmt.Sprintf("error retrieving the attachement status %q: %s", disk, err))
 			}
 		}
 
-		formatted, err := d.mounter.IsFormatted(source)
+		signature, err := d.mounter.Probe(source)
 		if err != nil {
 			return nil, err
 		}
 
-		if !formatted {
-			log.Info("formatting the volume for staging")
-			if err := d.mounter.Format(source, fsType); err != nil {
+		if signature.IsFilesystem() {
+			log.Info("source device is already formatted", "source_fs_type", signature.Type)
+		} else if readOnly {
+			return nil, status.Errorf(codes.FailedPrecondition,
+				"NodeStageVolume refusing to format read only volume %q, it contains %s", req.VolumeId, signature)
+		} else {
+			// never overwrite partition tables, LVM physical volumes, LUKS
+			// headers or other data that is not a filesystem we can mount
+			if !signature.IsEmpty() {
+				if !forceFormat {
+					return nil, status.Errorf(codes.FailedPrecondition,
+						"NodeStageVolume refusing to format device of volume %q, it contains %s; set the %q parameter to format it anyway",
+						req.VolumeId, signature, forceFormatParameter)
+				}
+				log.Warn("wiping the signatures of the source device, as formatting is forced", "signature", signature.String())
+			}
+
+			// never format the device of another volume
+			if err := d.mounter.VerifyDeviceSerial(disk, hints); err != nil {
+				return nil, status.Errorf(codes.FailedPrecondition, "NodeStageVolume refusing to format device of volume %q: %v", req.VolumeId, err)
+			}
+
+			mkfsArgs, err := mkfsArgsFromParameters(fsType, req.VolumeContext)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "NodeStageVolume invalid mkfs parameters: %v", err)
+			}
+
+			if !signature.IsEmpty() {
+				if err := d.mounter.Wipe(source); err != nil {
+					return nil, status.Error(codes.Internal, err.Error())
+				}
+			}
+
+			log.With("mkfs_args", mkfsArgs).Info("formatting the volume for staging")
+			if err := d.mounter.Format(source, fsType, mkfsArgs...); err != nil {
 				return nil, status.Error(codes.Internal, err.Error())
 			}
-		} else {
-			log.Info("source device is already formatted")
+			// a new filesystem does not need to be checked
+			checkFs = false
 		}
 	}
 
@@ -140,6 +217,12 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 	}
 
 	if !mounted {
+		if checkFs {
+			if err := d.checkFilesystem(ctx, req.VolumeId, req.VolumeContext, source, fsType, repairFs, log); err != nil {
+				return nil, err
+			}
+		}
+
 		if err := d.mounter.Mount(source, target, fsType, options...); err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
 		}
@@ -147,7 +230,7 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 		log.Info("source device is already mounted to the target path")
 	}
 
-	if _, err := os.Stat(source); err == nil {
+	if _, err := os.Stat(source); err == nil && !readOnly {
 		r := mountutil.NewResizeFs(utilexec.New())
 		needResize, err := r.NeedResize(source, target)
 
@@ -194,6 +277,7 @@ func (d *Driver) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolu
 	} else {
 		log.Info("staging target path is already unmounted")
 	}
+	d.clearVolumeCondition(req.VolumeId)
 
 	log.Info("unmounting stage volume is finished")
 	return &csi.NodeUnstageVolumeResponse{}, nil
@@ -205,6 +289,16 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume Volume ID must be provided")
 	}
 
+	if isEphemeralVolume(req.VolumeContext) {
+		if req.TargetPath == "" {
+			return nil, status.Error(codes.InvalidArgument, "NodePublishVolume Target Path must be provided")
+		}
+		if req.VolumeCapability == nil {
+			return nil, status.Error(codes.InvalidArgument, "NodePublishVolume Volume Capability must be provided")
+		}
+		return d.nodePublishEphemeralVolume(ctx, req)
+	}
+
 	if req.StagingTargetPath == "" {
 		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume Staging Target Path must be provided")
 	}
@@ -221,14 +315,14 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 	log.Info("node publish volume called")
 
 	options := []string{"bind"}
-	if req.Readonly {
+	if req.Readonly || isReadOnlyAccessMode(req.VolumeCapability.GetAccessMode()) {
 		options = append(options, "ro")
 	}
 
 	var err error
 	switch req.GetVolumeCapability().GetAccessType().(type) {
 	case *csi.VolumeCapability_Block:
-		err = d.nodePublishVolumeForBlock(req, options, log)
+		err = d.nodePublishVolumeForBlock(ctx, req, options, log)
 	case *csi.VolumeCapability_Mount:
 		err = d.nodePublishVolumeForFileSystem(req, options, log)
 	default:
@@ -261,6 +355,10 @@ func (d *Driver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublish
 		return nil, err
 	}
 
+	if err := d.nodeUnpublishEphemeralVolume(ctx, req.VolumeId, log); err != nil {
+		return nil, err
+	}
+
 	log.Info("unmounting volume is finished")
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
@@ -289,6 +387,20 @@ func (d *Driver) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabi
 				},
 			},
 		},
+		{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+				},
+			},
+		},
+		{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+				},
+			},
+		},
 	}
 
 	d.log.With("node_capabilities", nscaps, "method", "node_get_capabilities").Info("node get capabilities called")
@@ -335,13 +447,24 @@ func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeS
 	}
 
 	// For block volumes, we need to get the actual device path, not the target path
-	var actualPath string
+	var actualPath, devicePath string
 	var isBlock bool
 	if isBlock, err = d.mounter.IsBlockDevice(volumePath); err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to determine if %q is block device: %s", volumePath, err)
 	} else if isBlock {
-		// For block volumes, get the actual device path from the mount
-		devicePath, err := d.mounter.GetDeviceName(d.mounter.GetKMounter(), volumePath)
+		// the target of a block volume is a bind mounted device file
+		devicePath, err = d.mounter.GetBlockDevice(volumePath)
+		if errors.Is(err, ErrDeviceNotFound) {
+			// the device was removed from the node, which is a condition
+			// of the volume rather than a failure to get its statistics
+			log.Warn("device of block volume was not found", "error", err)
+			return &csi.NodeGetVolumeStatsResponse{
+				VolumeCondition: &csi.VolumeCondition{
+					Abnormal: true,
+					Message:  fmt.Sprintf("device of block volume is gone: %v", err),
+				},
+			}, nil
+		}
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "failed to get device name for block volume %q: %s", volumePath, err)
 		}
@@ -366,6 +489,7 @@ func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeS
 					Total: stats.totalBytes,
 				},
 			},
+			VolumeCondition: d.nodeVolumeCondition(req.VolumeId, volumePath, devicePath, log),
 		}, nil
 	}
 
@@ -393,6 +517,7 @@ func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeS
 				Unit:      csi.VolumeUsage_INODES,
 			},
 		},
+		VolumeCondition: d.nodeVolumeCondition(req.VolumeId, volumePath, devicePath, log),
 	}, nil
 }
 
@@ -410,14 +535,6 @@ func (d *Driver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolume
 	log := d.log.With("volume_id", req.VolumeId, "volume_path", req.VolumePath, "method", "node_expand_volume")
 	log.Info("node expand volume called")
 
-	if req.GetVolumeCapability() != nil {
-		switch req.GetVolumeCapability().GetAccessType().(type) {
-		case *csi.VolumeCapability_Block:
-			log.Info("filesystem expansion is skipped for block volumes")
-			return &csi.NodeExpandVolumeResponse{}, nil
-		}
-	}
-
 	mounted, err := d.mounter.IsMounted(volumePath)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "NodeExpandVolume failed to check if volume path %q is mounted: %s", volumePath, err)
@@ -427,25 +544,78 @@ func (d *Driver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolume
 		return nil, status.Errorf(codes.NotFound, "NodeExpandVolume volume path %q is not mounted", volumePath)
 	}
 
-	mounter := mountutil.New("")
-	devicePath, err := d.mounter.GetDeviceName(mounter, volumePath)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "NodeExpandVolume unable to get device path for %q: %v", volumePath, err)
+	var isBlock bool
+	if req.GetVolumeCapability() != nil {
+		isBlock = req.GetVolumeCapability().GetBlock() != nil
+	} else if isBlock, err = d.mounter.IsBlockDevice(volumePath); err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeExpandVolume failed to determine if %q is block device: %s", volumePath, err)
+	}
+
+	var devicePath string
+	if isBlock {
+		devicePath, err = d.mounter.GetBlockDevice(volumePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "NodeExpandVolume unable to get device of block volume %q: %v", volumePath, err)
+		}
+		log = log.With("volume_mode", volumeModeBlock)
+	} else {
+		devicePath, err = d.mounter.GetDeviceName(mountutil.New(""), volumePath)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "NodeExpandVolume unable to get device path for %q: %v", volumePath, err)
+		}
+		log = log.With("volume_mode", volumeModeFilesystem)
 	}
 
 	if devicePath == "" {
 		return nil, status.Errorf(codes.NotFound, "NodeExpandVolume device path for volume path %q not found", volumePath)
 	}
 
-	r := mountutil.NewResizeFs(utilexec.New())
 	log = log.With("device_path", devicePath)
+
+	// the guest only sees the new size of a SCSI disk after a rescan
+	size, err := d.mounter.RescanDevice(devicePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeExpandVolume could not rescan device of volume %q (%q): %v", volumeID, devicePath, err)
+	}
+	if required := req.GetCapacityRange().GetRequiredBytes(); size < required {
+		return nil, status.Errorf(codes.Unavailable, "NodeExpandVolume device of volume %q is %s, expected at least %s, it may not have been resized yet",
+			volumeID, formatBytes(size), formatBytes(required))
+	}
+	log = log.With("device_size_bytes", size)
+
+	if isBlock {
+		log.Info("block volume was expanded")
+		return &csi.NodeExpandVolumeResponse{CapacityBytes: size}, nil
+	}
+
+	// volumes staged from a partition need the partition to be grown first
+	if err := d.mounter.GrowPartition(devicePath); err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeExpandVolume could not grow partition of volume %q (%q): %v", volumeID, devicePath, err)
+	}
+
+	r := mountutil.NewResizeFs(utilexec.New())
 	log.Info("resizing volume")
 	if _, err := r.Resize(devicePath, volumePath); err != nil {
 		return nil, status.Errorf(codes.Internal, "NodeExpandVolume could not resize volume %q (%q):  %v", volumeID, req.GetVolumePath(), err)
 	}
 
-	log.Info("volume was resized")
-	return &csi.NodeExpandVolumeResponse{}, nil
+	// the filesystem is smaller than its device because of its metadata, so
+	// whether it fills the device is left to the resizer
+	needResize, err := r.NeedResize(devicePath, volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeExpandVolume could not determine if volume %q was resized: %v", volumeID, err)
+	}
+	if needResize {
+		return nil, status.Errorf(codes.Internal, "NodeExpandVolume filesystem of volume %q does not fill its device of %s after resizing", volumeID, formatBytes(size))
+	}
+
+	stats, err := d.mounter.GetStatistics(volumePath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeExpandVolume could not get statistics of volume %q (%q): %v", volumeID, volumePath, err)
+	}
+
+	log.Info("volume was resized", "filesystem_size_bytes", stats.totalBytes)
+	return &csi.NodeExpandVolumeResponse{CapacityBytes: stats.totalBytes}, nil
 }
 
 func (d *Driver) nodePublishVolumeForFileSystem(req *csi.NodePublishVolumeRequest, mountOptions []string, log *slog.Logger) error {
@@ -479,10 +649,20 @@ func (d *Driver) nodePublishVolumeForFileSystem(req *csi.NodePublishVolumeReques
 	return nil
 }
 
-func (d *Driver) nodePublishVolumeForBlock(req *csi.NodePublishVolumeRequest, mountOptions []string, log *slog.Logger) error {
+func (d *Driver) nodePublishVolumeForBlock(ctx context.Context, req *csi.NodePublishVolumeRequest, mountOptions []string, log *slog.Logger) error {
+	devicePath, err := d.mounter.GetDeviceByID(ctx, req.VolumeId, d.deviceHints(req.PublishContext))
+	if err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			return status.Errorf(codes.Unavailable, "Failed to find device path for volume %s. %v", req.VolumeId, err)
+		}
+		return status.Errorf(codes.Internal, "Failed to find device path for volume %s. %v", req.VolumeId, err)
+	}
 
-	source, err := findAbsoluteDeviceByIDPath(req.VolumeId)
+	source, err := resolveDevicePath(devicePath)
 	if err != nil {
+		if errors.Is(err, ErrDeviceNotFound) {
+			return status.Errorf(codes.Unavailable, "Failed to find device path for volume %s. %v", req.VolumeId, err)
+		}
 		return status.Errorf(codes.Internal, "Failed to find device path for volume %s. %v", req.VolumeId, err)
 	}
 
@@ -512,10 +692,31 @@ func getDeviceByIDPath(volumeName string) string {
 	return filepath.Join(diskIDPath, fmt.Sprintf("%s%s", diskByIdPrefix, volumeName))
 }
 
-// findAbsoluteDeviceByIDPath follows the /dev/disk/by-id symlink to find the absolute path of a device
-func findAbsoluteDeviceByIDPath(volumeName string) (string, error) {
-	path := getDeviceByIDPath(volumeName)
+// readOnlyMountOptions returns the options to mount a filesystem read only
+// without replaying its journal, so a volume that was not cleanly unmounted
+// can still be mounted read only.
+func readOnlyMountOptions(fsType string) []string {
+	switch fsType {
+	case "ext3", "ext4":
+		return []string{"ro", "noload"}
+	case "xfs":
+		return []string{"ro", "norecovery"}
+	}
+	return []string{"ro"}
+}
+
+// deviceHints returns the hints the controller passed in the publish
+// context to find the device of the volume.
+func (d *Driver) deviceHints(publishContext map[string]string) deviceHints {
+	return deviceHints{
+		Serial:       publishContext[d.publishInfoSerial],
+		AttachmentID: publishContext[d.publishInfoAttachment],
+		Bus:          publishContext[d.publishInfoBus],
+	}
+}
 
+// resolveDevicePath follows the /dev/disk/by-id symlink to find the absolute path of a device
+func resolveDevicePath(path string) (string, error) {
 	// EvalSymlinks returns relative link if the file is not a symlink
 	// so we do not have to check if it is symlink prior to evaluation
 	resolved, err := filepath.EvalSymlinks(path)
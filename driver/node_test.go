@@ -18,6 +18,7 @@ package driver
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"testing"
@@ -91,6 +92,21 @@ func TestNodeStageVolume(t *testing.T) {
 			},
 			expectedError: status.Error(codes.InvalidArgument, "NodeStageVolume Volume Capability must be provided"),
 		},
+		{
+			name: "unsupported fs type",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "test-volume",
+				StagingTargetPath: "/tmp/staging",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext5",
+						},
+					},
+				},
+			},
+			expectedError: status.Error(codes.InvalidArgument, `NodeStageVolume unsupported fs type "ext5", supported fs types are: ext3, ext4, xfs, btrfs`),
+		},
 		{
 			name: "device not attached",
 			req: &csi.NodeStageVolumeRequest{
@@ -111,6 +127,47 @@ func TestNodeStageVolume(t *testing.T) {
 			},
 			expectedError: status.Error(codes.Internal, "error retrieving the attachement status \"/dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_test-volume\": device not attached"),
 		},
+		{
+			name: "device of another volume is not formatted",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "test-volume",
+				StagingTargetPath: "/tmp/staging",
+				PublishContext: map[string]string{
+					"csi.k8s.thalassa.cloud/serial": "serial-1",
+				},
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+				},
+			},
+			mockSetup: func(m *MockMounter) {
+				devicePath := "/dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_test-volume"
+				m.AttachedDevices[devicePath] = true
+				m.DeviceSerials[devicePath] = "serial-2"
+			},
+			expectedError: status.Error(codes.FailedPrecondition, "NodeStageVolume refusing to format device of volume \"test-volume\": device serial mismatch"),
+		},
+		{
+			name: "device did not appear",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "test-volume",
+				StagingTargetPath: "/tmp/staging",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+				},
+			},
+			mockSetup: func(m *MockMounter) {
+				m.DeviceErrors["test-volume"] = fmt.Errorf("%w: device of volume %q did not appear within 30s", ErrDeviceNotFound, "test-volume")
+			},
+			expectedError: status.Error(codes.Unavailable, "NodeStageVolume failed to find device of volume \"test-volume\": device not found: device of volume \"test-volume\" did not appear within 30s"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -124,6 +181,7 @@ func TestNodeStageVolume(t *testing.T) {
 				mounter:            mockMounter,
 				log:                slog.New(slog.NewTextHandler(os.Stdout, nil)),
 				validateAttachment: true,
+				publishInfoSerial:  "csi.k8s.thalassa.cloud/serial",
 			}
 
 			resp, err := driver.NodeStageVolume(context.Background(), tt.req)
@@ -139,6 +197,174 @@ func TestNodeStageVolume(t *testing.T) {
 	}
 }
 
+func TestNodeStageVolumeSafeFormat(t *testing.T) {
+	devicePath := "/dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_test-volume"
+
+	tests := []struct {
+		name           string
+		volumeContext  map[string]string
+		fsType         string
+		partitionTable string
+		wantFormatted  bool
+		wantWiped      bool
+		wantErr        error
+	}{
+		{
+			name:          "empty device is formatted",
+			wantFormatted: true,
+		},
+		{
+			name:   "filesystem is mounted",
+			fsType: "xfs",
+		},
+		{
+			name:           "partition table is not formatted",
+			partitionTable: "gpt",
+			wantErr:        status.Error(codes.FailedPrecondition, `NodeStageVolume refusing to format device of volume "test-volume", it contains a gpt partition table; set the "force-format" parameter to format it anyway`),
+		},
+		{
+			name:    "LVM physical volume is not formatted",
+			fsType:  fsTypeLVM,
+			wantErr: status.Error(codes.FailedPrecondition, `NodeStageVolume refusing to format device of volume "test-volume", it contains a LVM2_member signature; set the "force-format" parameter to format it anyway`),
+		},
+		{
+			name:           "filesystem in a partition table is not formatted",
+			fsType:         "ext4",
+			partitionTable: "dos",
+			wantErr:        status.Error(codes.FailedPrecondition, `NodeStageVolume refusing to format device of volume "test-volume", it contains a dos partition table and a ext4 signature; set the "force-format" parameter to format it anyway`),
+		},
+		{
+			name:          "LUKS header is formatted when forced",
+			volumeContext: map[string]string{forceFormatParameter: "true"},
+			fsType:        fsTypeLUKS,
+			wantFormatted: true,
+			wantWiped:     true,
+		},
+		{
+			name:           "partition table is formatted with the annotation",
+			volumeContext:  map[string]string{"csi.k8s.thalassa.cloud/force-format": ""},
+			partitionTable: "dos",
+			wantFormatted:  true,
+			wantWiped:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMounter := NewMockMounter()
+			mockMounter.AttachedDevices[devicePath] = true
+			if tt.fsType != "" {
+				mockMounter.FormattedDevices[devicePath] = tt.fsType
+			}
+			if tt.partitionTable != "" {
+				mockMounter.PartitionTables[devicePath] = tt.partitionTable
+			}
+
+			driver := &Driver{
+				mounter: mockMounter,
+				log:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			}
+
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "test-volume",
+				StagingTargetPath: "/tmp/staging",
+				VolumeContext:     tt.volumeContext,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"},
+					},
+				},
+			})
+			if tt.wantErr != nil {
+				require.EqualError(t, err, tt.wantErr.Error())
+				require.Equal(t, tt.fsType, mockMounter.FormattedDevices[devicePath])
+				require.NotContains(t, mockMounter.MountPoints, "/tmp/staging")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantWiped, mockMounter.WipedDevices[devicePath])
+			if tt.wantFormatted {
+				require.Equal(t, "ext4", mockMounter.FormattedDevices[devicePath])
+			} else {
+				require.Equal(t, tt.fsType, mockMounter.FormattedDevices[devicePath])
+			}
+		})
+	}
+}
+
+func TestNodeStageVolumeReadOnly(t *testing.T) {
+	devicePath := "/dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_test-volume"
+
+	tests := []struct {
+		name        string
+		mode        csi.VolumeCapability_AccessMode_Mode
+		fsType      string
+		formatted   bool
+		wantOptions []string
+		wantErr     error
+	}{
+		{
+			name:        "ext4 journal is not replayed",
+			mode:        csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+			fsType:      "ext4",
+			formatted:   true,
+			wantOptions: []string{"ro", "noload"},
+		},
+		{
+			name:        "xfs log is not recovered",
+			mode:        csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+			fsType:      "xfs",
+			formatted:   true,
+			wantOptions: []string{"ro", "norecovery"},
+		},
+		{
+			name:    "empty volume is not formatted",
+			mode:    csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+			fsType:  "ext4",
+			wantErr: status.Error(codes.FailedPrecondition, `NodeStageVolume refusing to format read only volume "test-volume", it contains no signature`),
+		},
+		{
+			name:      "writable volume",
+			mode:      csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			fsType:    "ext4",
+			formatted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMounter := NewMockMounter()
+			mockMounter.AttachedDevices[devicePath] = true
+			if tt.formatted {
+				mockMounter.FormattedDevices[devicePath] = tt.fsType
+			}
+
+			driver := &Driver{
+				mounter: mockMounter,
+				log:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			}
+
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "test-volume",
+				StagingTargetPath: "/tmp/staging",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{FsType: tt.fsType},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: tt.mode},
+				},
+			})
+			if tt.wantErr != nil {
+				require.EqualError(t, err, tt.wantErr.Error())
+				require.Empty(t, mockMounter.FormattedDevices)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantOptions, mockMounter.MountOptions["/tmp/staging"])
+		})
+	}
+}
+
 func TestNodeUnstageVolume(t *testing.T) {
 	tests := []struct {
 		name          string
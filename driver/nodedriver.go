@@ -33,6 +33,8 @@ import (
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 
+	iaas "github.com/thalassa-cloud/client-go/iaas"
+
 	"github.com/thalassa-cloud/csi-thalassa/driver/defaults"
 )
 
@@ -48,9 +50,32 @@ type NewNodeDriverParams struct {
 	Vpc                string
 	Project            string
 	Cluster            string
+	KubeConfig         string
+
+	// MountPropagationMode is strict, warn or ignore
+	MountPropagationMode string
+	KubeletDir           string
+
+	// DeviceWaitTimeout and DeviceWaitInterval define how long and how often
+	// NodeStageVolume looks for the device of an attached volume
+	DeviceWaitTimeout  time.Duration
+	DeviceWaitInterval time.Duration
 
 	CustomLabels      string
 	CustomAnnotations string
+
+	// The Thalassa Cloud API is only used by the node to create inline
+	// ephemeral volumes, of the comma separated EphemeralVolumeTypes and
+	// at most EphemeralMaxSize bytes
+	ThalassaToken          string
+	ThalassaClientID       string
+	ThalassaClientSecret   string
+	ThalassaURL            string
+	ThalassaOrganisation   string
+	ThalassaInsecure       bool
+	EphemeralVolumeTypes   string
+	EphemeralMaxSize       int64
+	EphemeralSweepInterval time.Duration
 }
 
 // NewDriver returns a CSI plugin that contains the necessary gRPC
@@ -66,21 +91,74 @@ func NewNodeDriver(p NewNodeDriverParams) (*Driver, error) {
 
 	log := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
+	propagationMode, err := parsePropagationMode(p.MountPropagationMode)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralVolumeTypes := parseVolumeTypes(p.EphemeralVolumeTypes)
+	var iaasClient *iaas.Client
+	if len(ephemeralVolumeTypes) > 0 {
+		log.Info("Inline ephemeral volumes enabled", "volume_types", ephemeralVolumeTypes, "max_size", p.EphemeralMaxSize)
+		iaasClient, err = newIaasClient(log, apiClientParams{
+			URL:          p.ThalassaURL,
+			Organisation: p.ThalassaOrganisation,
+			Project:      p.Project,
+			Token:        p.ThalassaToken,
+			ClientID:     p.ThalassaClientID,
+			ClientSecret: p.ThalassaClientSecret,
+			Insecure:     p.ThalassaInsecure,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ephemeralSweepInterval := p.EphemeralSweepInterval
+	if ephemeralSweepInterval <= 0 {
+		ephemeralSweepInterval = defaultEphemeralSweepInterval
+	}
+
+	// events are only logged when there is no access to the Kubernetes API
+	var recorder eventRecorder
+	if kubeRecorder, err := newKubeEventRecorder(p.KubeConfig, driverName, nodeId); err != nil {
+		log.Warn("unable to record events for persistent volume claims", "error", err)
+	} else {
+		recorder = kubeRecorder
+	}
+
 	return &Driver{
-		debugAddr:             p.DebugAddr,
-		endpoint:              p.CsiEndpoint,
-		log:                   log,
-		mounter:               NewMounter(log),
-		name:                  driverName,
-		nodeID:                nodeId,
-		publishInfoVolumeName: driverName + "/volume-name",
-		region:                p.Region,
-		validateAttachment:    p.ValidateAttachment,
-		volumeLimit:           p.VolumeLimit,
-		vpc:                   p.Vpc,
-		clusterIdentity:       p.Cluster,
-		CustomLabels:          parseCustomLabels(p.CustomLabels),
-		CustomAnnotations:     parseCustomLabels(p.CustomAnnotations),
+		debugAddr: p.DebugAddr,
+		endpoint:  p.CsiEndpoint,
+		log:       log,
+		mounter: NewMounter(log, mounterOptions{
+			propagationMode:    propagationMode,
+			kubeletDir:         p.KubeletDir,
+			deviceWaitTimeout:  p.DeviceWaitTimeout,
+			deviceWaitInterval: p.DeviceWaitInterval,
+		}),
+		propagationMode:        propagationMode,
+		kubeletDir:             p.KubeletDir,
+		name:                   driverName,
+		nodeID:                 nodeId,
+		publishInfoVolumeName:  driverName + "/volume-name",
+		publishInfoSerial:      driverName + "/serial",
+		publishInfoAttachment:  driverName + "/attachment-identity",
+		publishInfoBus:         driverName + "/bus",
+		region:                 p.Region,
+		validateAttachment:     p.ValidateAttachment,
+		volumeLimit:            p.VolumeLimit,
+		vpc:                    p.Vpc,
+		clusterIdentity:        p.Cluster,
+		kubeConfig:             p.KubeConfig,
+		eventRecorder:          recorder,
+		CustomLabels:           parseCustomLabels(p.CustomLabels),
+		CustomAnnotations:      parseCustomLabels(p.CustomAnnotations),
+		iaas:                   iaasClient,
+		projectId:              p.Project,
+		ephemeralVolumeTypes:   ephemeralVolumeTypes,
+		ephemeralMaxSize:       p.EphemeralMaxSize,
+		ephemeralSweepInterval: ephemeralSweepInterval,
 	}, nil
 }
 
@@ -122,6 +200,8 @@ func (d *Driver) RunNode(ctx context.Context) error {
 		return fmt.Errorf("failed to remove unix domain socket file %s, error: %s", grpcAddr, err)
 	}
 
+	d.checkKubeletMountPropagation()
+
 	grpcListener, err := net.Listen(u.Scheme, grpcAddr)
 	if err != nil {
 		return fmt.Errorf("failed to listen: %v", err)
@@ -159,6 +239,9 @@ func (d *Driver) RunNode(ctx context.Context) error {
 			return err
 		})
 	}
+	if d.ephemeralVolumesEnabled() {
+		go d.runEphemeralVolumeSweeper(ctx)
+	}
 	eg.Go(func() error {
 		go func() {
 			<-ctx.Done()
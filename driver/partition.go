@@ -0,0 +1,201 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// partitionParameter selects the partition of the volume that is staged
+	// instead of the whole disk, e.g. for volumes restored from a machine
+	// image. It is a partition number, or auto to stage the only partition of
+	// the volume. It is passed to the node via the volume context.
+	partitionParameter = "partition"
+	partitionAuto      = "auto"
+)
+
+// annsPartitionVolume can be added to the volume attributes of a PV to
+// select the partition of a static volume.
+var annsPartitionVolume = []string{
+	"csi.k8s.thalassa.cloud/partition",
+}
+
+// partitionOption returns the partition to stage from the volume context:
+// an empty string for the whole disk, auto, or a partition number.
+func partitionOption(volumeContext map[string]string) (string, error) {
+	for _, p := range append([]string{partitionParameter}, annsPartitionVolume...) {
+		v, ok := volumeContext[p]
+		if !ok || v == "" {
+			continue
+		}
+		if v == partitionAuto {
+			return v, nil
+		}
+		if n, err := strconv.Atoi(v); err != nil || n < 1 {
+			return "", fmt.Errorf("parameter %q must be a partition number or %q, got %q", p, partitionAuto, v)
+		}
+		return v, nil
+	}
+	return "", nil
+}
+
+// devicePartition is a partition of a disk.
+type devicePartition struct {
+	// Name is the kernel name of the partition, e.g. sda1 or nvme0n1p1
+	Name string
+	// Number is the partition number
+	Number int
+}
+
+// partitions returns the partitions of the disk ordered by number, as the
+// kernel reports them in /sys/block/<disk>/<partition>/partition.
+func (dm *deviceManager) partitions(devicePath string) ([]devicePartition, error) {
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionFiles, err := filepath.Glob(filepath.Join(dm.sysBlockPath, filepath.Base(resolved), "*", "partition"))
+	if err != nil {
+		return nil, err
+	}
+
+	var partitions []devicePartition
+	for _, partitionFile := range partitionFiles {
+		content, err := os.ReadFile(partitionFile)
+		if err != nil {
+			return nil, err
+		}
+		number, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid partition number in %q: %v", partitionFile, err)
+		}
+		partitions = append(partitions, devicePartition{
+			Name:   filepath.Base(filepath.Dir(partitionFile)),
+			Number: number,
+		})
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Number < partitions[j].Number })
+	return partitions, nil
+}
+
+// GetPartition returns the device path of the partition of the device. With
+// auto, the only partition is returned, or the device itself when it has no
+// partitions. The by-id link of the partition is preferred over the kernel
+// name, as it is stable.
+func (dm *deviceManager) GetPartition(devicePath string, partition string) (string, error) {
+	partitions, err := dm.partitions(devicePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to list partitions of device %q: %v", devicePath, err)
+	}
+
+	var found devicePartition
+	if partition == partitionAuto {
+		switch len(partitions) {
+		case 0:
+			dm.log.Info("device has no partitions, using the whole device", "device_path", devicePath)
+			return devicePath, nil
+		case 1:
+			found = partitions[0]
+		default:
+			var names []string
+			for _, p := range partitions {
+				names = append(names, p.Name)
+			}
+			return "", fmt.Errorf("%w: device %q has %d partitions (%s), select one with the %q parameter",
+				ErrPartitionNotFound, devicePath, len(partitions), strings.Join(names, ", "), partitionParameter)
+		}
+	} else {
+		number, err := strconv.Atoi(partition)
+		if err != nil {
+			return "", fmt.Errorf("invalid partition %q: %v", partition, err)
+		}
+		i := sort.Search(len(partitions), func(i int) bool { return partitions[i].Number >= number })
+		if i == len(partitions) || partitions[i].Number != number {
+			return "", fmt.Errorf("%w: device %q has no partition %d", ErrPartitionNotFound, devicePath, number)
+		}
+		found = partitions[i]
+	}
+
+	link := fmt.Sprintf("%s-part%d", devicePath, found.Number)
+	if _, err := os.Stat(link); err == nil {
+		return link, nil
+	}
+	return filepath.Join(dm.devPath, found.Name), nil
+}
+
+// GrowPartition grows the partition to the end of its disk. Devices that are
+// not partitions are left as they are.
+func (dm *deviceManager) GrowPartition(devicePath string) error {
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(resolved)
+
+	partitionFiles, err := filepath.Glob(filepath.Join(dm.sysBlockPath, "*", name, "partition"))
+	if err != nil {
+		return err
+	}
+	if len(partitionFiles) == 0 {
+		return nil
+	}
+
+	content, err := os.ReadFile(partitionFiles[0])
+	if err != nil {
+		return err
+	}
+	number, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return fmt.Errorf("invalid partition number in %q: %v", partitionFiles[0], err)
+	}
+	disk := filepath.Join(dm.devPath, filepath.Base(filepath.Dir(filepath.Dir(partitionFiles[0]))))
+
+	dm.log.Info("growing the partition", "device_path", devicePath, "disk", disk, "partition", number)
+	if dm.growPartition == nil {
+		return errors.New("growing partitions is not supported")
+	}
+	return dm.growPartition(disk, number)
+}
+
+// growpart grows the partition of the disk with growpart(1), which reports
+// NOCHANGE when the partition already fills the disk.
+func growpart(disk string, partition int) error {
+	growpartCmd := "growpart"
+	if _, err := exec.LookPath(growpartCmd); err != nil {
+		return fmt.Errorf("%q executable not found in $PATH", growpartCmd)
+	}
+
+	args := []string{disk, strconv.Itoa(partition)}
+	out, err := exec.Command(growpartCmd, args...).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "NOCHANGE") {
+			return nil
+		}
+		return fmt.Errorf("growing partition failed: %v cmd: '%s %s' output: %q",
+			err, growpartCmd, strings.Join(args, " "), string(out))
+	}
+	return nil
+}
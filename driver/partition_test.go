@@ -0,0 +1,183 @@
+package driver
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+)
+
+// addPartition adds a partition of the disk to the sysfs and /dev trees of
+// the device manager.
+func addPartition(t *testing.T, dm *deviceManager, disk, name string, number int) string {
+	t.Helper()
+
+	device := filepath.Join(dm.devPath, name)
+	require.NoError(t, os.WriteFile(device, nil, 0600))
+	dir := filepath.Join(dm.sysBlockPath, disk, name)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "partition"), []byte(strconv.Itoa(number)+"\n"), 0644))
+	return device
+}
+
+func TestPartitionOption(t *testing.T) {
+	tests := []struct {
+		name          string
+		volumeContext map[string]string
+		want          string
+		wantErr       string
+	}{
+		{
+			name: "whole disk by default",
+		},
+		{
+			name:          "partition number",
+			volumeContext: map[string]string{partitionParameter: "2"},
+			want:          "2",
+		},
+		{
+			name:          "auto",
+			volumeContext: map[string]string{partitionParameter: "auto"},
+			want:          "auto",
+		},
+		{
+			name:          "annotation",
+			volumeContext: map[string]string{"csi.k8s.thalassa.cloud/partition": "1"},
+			want:          "1",
+		},
+		{
+			name:          "invalid partition",
+			volumeContext: map[string]string{partitionParameter: "0"},
+			wantErr:       `parameter "partition" must be a partition number or "auto", got "0"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := partitionOption(tt.volumeContext)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDeviceManagerGetPartition(t *testing.T) {
+	t.Run("partition number", func(t *testing.T) {
+		dm := testDeviceManager(t)
+		disk := addDevice(t, dm, "sdb", "", "", "")
+		addPartition(t, dm, "sdb", "sdb1", 1)
+		want := addPartition(t, dm, "sdb", "sdb2", 2)
+
+		got, err := dm.GetPartition(disk, "2")
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("prefers the by-id link", func(t *testing.T) {
+		dm := testDeviceManager(t)
+		addDevice(t, dm, "sdb", "scsi-0QEMU_QEMU_HARDDISK_vol-1", "", "")
+		partition := addPartition(t, dm, "sdb", "sdb1", 1)
+		link := filepath.Join(dm.byIDPath, "scsi-0QEMU_QEMU_HARDDISK_vol-1-part1")
+		require.NoError(t, os.Symlink(partition, link))
+
+		got, err := dm.GetPartition(filepath.Join(dm.byIDPath, "scsi-0QEMU_QEMU_HARDDISK_vol-1"), "1")
+		require.NoError(t, err)
+		require.Equal(t, link, got)
+	})
+
+	t.Run("missing partition", func(t *testing.T) {
+		dm := testDeviceManager(t)
+		disk := addDevice(t, dm, "sdb", "", "", "")
+		addPartition(t, dm, "sdb", "sdb1", 1)
+
+		_, err := dm.GetPartition(disk, "3")
+		require.ErrorIs(t, err, ErrPartitionNotFound)
+	})
+
+	t.Run("auto without partitions uses the disk", func(t *testing.T) {
+		dm := testDeviceManager(t)
+		disk := addDevice(t, dm, "sdb", "", "", "")
+
+		got, err := dm.GetPartition(disk, partitionAuto)
+		require.NoError(t, err)
+		require.Equal(t, disk, got)
+	})
+
+	t.Run("auto with a single partition", func(t *testing.T) {
+		dm := testDeviceManager(t)
+		disk := addDevice(t, dm, "nvme0n1", "", "", "")
+		want := addPartition(t, dm, "nvme0n1", "nvme0n1p1", 1)
+
+		got, err := dm.GetPartition(disk, partitionAuto)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("auto with multiple partitions", func(t *testing.T) {
+		dm := testDeviceManager(t)
+		disk := addDevice(t, dm, "sdb", "", "", "")
+		addPartition(t, dm, "sdb", "sdb1", 1)
+		addPartition(t, dm, "sdb", "sdb2", 2)
+
+		_, err := dm.GetPartition(disk, partitionAuto)
+		require.ErrorIs(t, err, ErrPartitionNotFound)
+		require.ErrorContains(t, err, "sdb1, sdb2")
+	})
+}
+
+func TestDeviceManagerGrowPartition(t *testing.T) {
+	dm := testDeviceManager(t)
+	disk := addDevice(t, dm, "sdb", "", "", "")
+	partition := addPartition(t, dm, "sdb", "sdb2", 2)
+
+	var grown []string
+	dm.growPartition = func(disk string, partition int) error {
+		grown = append(grown, disk+" "+strconv.Itoa(partition))
+		return nil
+	}
+
+	require.NoError(t, dm.GrowPartition(partition))
+	require.Equal(t, []string{filepath.Join(dm.devPath, "sdb") + " 2"}, grown)
+
+	// whole disks are left as they are
+	require.NoError(t, dm.GrowPartition(disk))
+	require.Len(t, grown, 1)
+}
+
+func TestNodeStageVolumePartition(t *testing.T) {
+	devicePath := "/dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_test-volume"
+
+	mockMounter := NewMockMounter()
+	mockMounter.AttachedDevices[devicePath] = true
+	mockMounter.PartitionTables[devicePath] = "gpt"
+	mockMounter.FormattedDevices[devicePath+"-part2"] = "ext4"
+
+	driver := &Driver{
+		mounter:            mockMounter,
+		log:                slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		validateAttachment: true,
+	}
+
+	_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+		VolumeId:          "test-volume",
+		StagingTargetPath: "/tmp/staging",
+		VolumeContext:     map[string]string{partitionParameter: "2"},
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, devicePath+"-part2", mockMounter.MountPoints["/tmp/staging"])
+	require.Empty(t, mockMounter.WipedDevices)
+}
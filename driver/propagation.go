@@ -0,0 +1,122 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// propagationMode defines how mounts without shared propagation are
+// treated when checking whether a target is mounted.
+type propagationMode string
+
+const (
+	// propagationStrict fails the check for mounts without shared
+	// propagation.
+	propagationStrict propagationMode = "strict"
+	// propagationWarn logs a warning for mounts without shared propagation.
+	propagationWarn propagationMode = "warn"
+	// propagationIgnore does not check the propagation of mounts.
+	propagationIgnore propagationMode = "ignore"
+
+	defaultKubeletDir = "/var/lib/kubelet"
+)
+
+// parsePropagationMode parses the mount propagation mode, defaulting to
+// strict.
+func parsePropagationMode(mode string) (propagationMode, error) {
+	switch propagationMode(mode) {
+	case "":
+		return propagationStrict, nil
+	case propagationStrict, propagationWarn, propagationIgnore:
+		return propagationMode(mode), nil
+	}
+	return "", fmt.Errorf("invalid mount propagation mode %q, must be one of strict, warn or ignore", mode)
+}
+
+// propagationRemediation describes how to enable shared propagation for the
+// mount the path is on.
+func propagationRemediation(mountPoint string) string {
+	return fmt.Sprintf("run `mount --make-rshared %s` on the node, or configure the host to mount it shared, "+
+		"and mount the kubelet directory into the node plugin with `mountPropagation: Bidirectional`. "+
+		"Use --mount-propagation-mode=warn or ignore to mount volumes regardless", mountPoint)
+}
+
+// mountForPath returns the mount the path is on, which is the mount with the
+// longest mount point that contains the path.
+func mountForPath(mounts []mountInfo, path string) (mountInfo, bool) {
+	path = filepath.Clean(path)
+
+	var found mountInfo
+	var ok bool
+	for _, mi := range mounts {
+		contains := mi.MountPoint == path || mi.MountPoint == "/" ||
+			strings.HasPrefix(path, mi.MountPoint+"/")
+		// later entries with the same mount point are stacked on top of the
+		// earlier ones
+		if contains && (!ok || len(mi.MountPoint) >= len(found.MountPoint)) {
+			found, ok = mi, true
+		}
+	}
+	return found, ok
+}
+
+// checkKubeletMountPropagation inspects the propagation of the mounts of the
+// kubelet plugins and pods directories and logs how to fix it when it is not
+// shared. Volumes staged or published there are not visible to the kubelet
+// and the pods without shared propagation.
+func (d *Driver) checkKubeletMountPropagation() {
+	kubeletDir := d.kubeletDir
+	if kubeletDir == "" {
+		kubeletDir = defaultKubeletDir
+	}
+
+	mounts, err := readMountInfo(mountInfoPath)
+	if err != nil {
+		d.log.Warn("unable to check the mount propagation of the kubelet directories", "error", err)
+		return
+	}
+
+	for _, dir := range []string{filepath.Join(kubeletDir, "plugins"), filepath.Join(kubeletDir, "pods")} {
+		mi, ok := mountForPath(mounts, dir)
+		if !ok {
+			d.log.Warn("unable to find the mount of the kubelet directory", "path", dir)
+			continue
+		}
+
+		propagation := mi.Propagation()
+		log := d.log.With("path", dir, "mount_point", mi.MountPoint, "propagation", propagation, "mount_propagation_mode", d.propagationMode)
+		if propagation == "shared" {
+			log.Info("mount propagation of the kubelet directory is shared")
+			continue
+		}
+
+		level := slog.LevelWarn
+		switch d.propagationMode {
+		case propagationStrict:
+			level = slog.LevelError
+		case propagationIgnore:
+			level = slog.LevelInfo
+		}
+		log.Log(context.Background(), level, "mount propagation of the kubelet directory is not shared",
+			"remediation", propagationRemediation(mi.MountPoint))
+	}
+}
@@ -0,0 +1,63 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePropagationMode(t *testing.T) {
+	mode, err := parsePropagationMode("")
+	require.NoError(t, err)
+	require.Equal(t, propagationStrict, mode)
+
+	mode, err = parsePropagationMode("warn")
+	require.NoError(t, err)
+	require.Equal(t, propagationWarn, mode)
+
+	_, err = parsePropagationMode("lenient")
+	require.EqualError(t, err, `invalid mount propagation mode "lenient", must be one of strict, warn or ignore`)
+}
+
+func TestMountForPath(t *testing.T) {
+	mounts, err := readMountInfo("testdata/mountinfo")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		path           string
+		wantMountPoint string
+	}{
+		{
+			name:           "kubelet plugins directory",
+			path:           "/var/lib/kubelet/plugins",
+			wantMountPoint: "/var/lib/kubelet",
+		},
+		{
+			name:           "kubelet directory itself",
+			path:           "/var/lib/kubelet/",
+			wantMountPoint: "/var/lib/kubelet",
+		},
+		{
+			name:           "directory with a common prefix",
+			path:           "/var/lib/kubelet-other",
+			wantMountPoint: "/",
+		},
+		{
+			name:           "volume mount",
+			path:           "/var/lib/kubelet/pods/pod-1/volumes/kubernetes.io~csi/pvc-1/mount/data",
+			wantMountPoint: "/var/lib/kubelet/pods/pod-1/volumes/kubernetes.io~csi/pvc-1/mount",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mi, ok := mountForPath(mounts, tt.path)
+			require.True(t, ok)
+			require.Equal(t, tt.wantMountPoint, mi.MountPoint)
+		})
+	}
+
+	_, ok := mountForPath(nil, "/var/lib/kubelet")
+	require.False(t, ok)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// disk returns the kernel name of the disk of the device, which is the
+// device itself or the disk a partition is on.
+func (dm *deviceManager) disk(devicePath string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(resolved)
+
+	if _, err := os.Stat(filepath.Join(dm.sysBlockPath, name)); err == nil {
+		return name, nil
+	}
+
+	partitionFiles, err := filepath.Glob(filepath.Join(dm.sysBlockPath, "*", name, "partition"))
+	if err != nil {
+		return "", err
+	}
+	if len(partitionFiles) == 0 {
+		return "", fmt.Errorf("%w: device %q is not a disk or partition in %s", ErrDeviceNotFound, devicePath, dm.sysBlockPath)
+	}
+	return filepath.Base(filepath.Dir(filepath.Dir(partitionFiles[0]))), nil
+}
+
+// RescanDevice asks the kernel to rescan the disk of the device, so that it
+// sees the new size of an expanded volume, and returns the size of the disk
+// in bytes. Disks that can not be rescanned, e.g. virtio disks which are
+// resized by the hypervisor, are only read.
+func (dm *deviceManager) RescanDevice(devicePath string) (int64, error) {
+	disk, err := dm.disk(devicePath)
+	if err != nil {
+		return 0, err
+	}
+
+	// /sys/block/<disk> is the same device as /sys/class/block/<disk>
+	rescanFile := filepath.Join(dm.sysBlockPath, disk, "device", "rescan")
+	if err := writeSysfs(rescanFile, "1"); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("failed to rescan disk %s: %v", disk, err)
+		}
+		dm.log.Info("disk can not be rescanned", "device_path", devicePath, "disk", disk)
+	} else {
+		dm.log.Info("rescanned disk", "device_path", devicePath, "disk", disk)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dm.sysBlockPath, disk, "size"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read size of disk %s: %v", disk, err)
+	}
+	sectors, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size of disk %s: %v", disk, err)
+	}
+	return sectors * sectorSize, nil
+}
+
+// writeSysfs writes the value to an existing sysfs attribute.
+func writeSysfs(path, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(value); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,144 @@
+package driver
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// addDiskSize sets the size of the disk in sysfs and, when rescan is set,
+// creates its rescan attribute.
+func addDiskSize(t *testing.T, dm *deviceManager, disk string, size int64, rescan bool) string {
+	t.Helper()
+
+	dir := filepath.Join(dm.sysBlockPath, disk)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "device"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "size"), []byte(strconv.FormatInt(size/sectorSize, 10)+"\n"), 0644))
+	rescanFile := filepath.Join(dir, "device", "rescan")
+	if rescan {
+		require.NoError(t, os.WriteFile(rescanFile, nil, 0644))
+	}
+	return rescanFile
+}
+
+func TestDeviceManagerRescanDevice(t *testing.T) {
+	t.Run("disk", func(t *testing.T) {
+		dm := testDeviceManager(t)
+		device := addDevice(t, dm, "sdb", "scsi-0QEMU_QEMU_HARDDISK_vol-1", "", "")
+		rescanFile := addDiskSize(t, dm, "sdb", 20*giB, true)
+
+		size, err := dm.RescanDevice(filepath.Join(dm.byIDPath, "scsi-0QEMU_QEMU_HARDDISK_vol-1"))
+		require.NoError(t, err)
+		require.Equal(t, int64(20*giB), size)
+
+		content, err := os.ReadFile(rescanFile)
+		require.NoError(t, err)
+		require.Equal(t, "1", string(content))
+		require.FileExists(t, device)
+	})
+
+	t.Run("partition rescans its disk", func(t *testing.T) {
+		dm := testDeviceManager(t)
+		addDevice(t, dm, "sdb", "", "", "")
+		rescanFile := addDiskSize(t, dm, "sdb", 30*giB, true)
+		partition := addPartition(t, dm, "sdb", "sdb1", 1)
+
+		size, err := dm.RescanDevice(partition)
+		require.NoError(t, err)
+		require.Equal(t, int64(30*giB), size)
+
+		content, err := os.ReadFile(rescanFile)
+		require.NoError(t, err)
+		require.Equal(t, "1", string(content))
+	})
+
+	t.Run("disk that can not be rescanned", func(t *testing.T) {
+		dm := testDeviceManager(t)
+		device := addDevice(t, dm, "vdb", "", "", "")
+		rescanFile := addDiskSize(t, dm, "vdb", 10*giB, false)
+
+		size, err := dm.RescanDevice(device)
+		require.NoError(t, err)
+		require.Equal(t, int64(10*giB), size)
+		require.NoFileExists(t, rescanFile)
+	})
+
+	t.Run("unknown device", func(t *testing.T) {
+		dm := testDeviceManager(t)
+		device := addDevice(t, dm, "sdc", "", "", "")
+
+		_, err := dm.RescanDevice(device)
+		require.ErrorIs(t, err, ErrDeviceNotFound)
+	})
+}
+
+func TestNodeExpandBlockVolume(t *testing.T) {
+	const (
+		targetPath = "/var/lib/kubelet/plugins/kubernetes.io/csi/volumeDevices/publish/pv-1/pod-1"
+		devicePath = "/dev/sdb"
+	)
+
+	tests := []struct {
+		name         string
+		deviceSize   int64
+		requiredSize int64
+		wantCode     codes.Code
+		wantCapacity int64
+	}{
+		{
+			name:         "device was resized",
+			deviceSize:   20 * giB,
+			requiredSize: 20 * giB,
+			wantCapacity: 20 * giB,
+		},
+		{
+			name:         "device is larger than required",
+			deviceSize:   21 * giB,
+			requiredSize: 20 * giB,
+			wantCapacity: 21 * giB,
+		},
+		{
+			name:         "device was not resized yet",
+			deviceSize:   10 * giB,
+			requiredSize: 20 * giB,
+			wantCode:     codes.Unavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMounter := NewMockMounter()
+			mockMounter.MountPoints[targetPath] = devicePath
+			mockMounter.DeviceSizes[devicePath] = tt.deviceSize
+
+			driver := &Driver{
+				mounter: mockMounter,
+				log:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			}
+
+			resp, err := driver.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+				VolumeId:      "test-volume",
+				VolumePath:    targetPath,
+				CapacityRange: &csi.CapacityRange{RequiredBytes: tt.requiredSize},
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+				},
+			})
+			require.True(t, mockMounter.RescannedDevices[devicePath])
+			if tt.wantCode != codes.OK {
+				require.Equal(t, tt.wantCode, status.Code(err), err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCapacity, resp.CapacityBytes)
+		})
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// filesystem types reported by probeFilesystem, matching the types
+	// reported by blkid
+	fsTypeLUKS = "crypto_LUKS"
+
+	// ext2/3/4 superblock, see
+	// https://www.kernel.org/doc/html/latest/filesystems/ext4/super.html
+	extSuperblockOffset      = 1024
+	extMagicOffset           = extSuperblockOffset + 0x38
+	extFeatureCompatOffset   = extSuperblockOffset + 0x5C
+	extFeatureIncompatOffset = extSuperblockOffset + 0x60
+	extFeatureROCompatOffset = extSuperblockOffset + 0x64
+	extMagic                 = 0xEF53
+	extCompatHasJournal      = 0x0004
+	extIncompatJournalDev    = 0x0008
+	extIncompatExt3Features  = 0x0002 | 0x0004 // filetype, recover
+	extROCompatExt2Features  = 0x0001 | 0x0002 | 0x0004
+
+	// xfs superblock, see xfs_sb.h
+	xfsMagicOffset = 0
+
+	// btrfs superblock, see
+	// https://btrfs.readthedocs.io/en/latest/dev/On-disk-format.html
+	btrfsMagicOffset = 64*1024 + 0x40
+
+	// LUKS1 and LUKS2 header, see the cryptsetup on-disk format
+	// specifications
+	luksMagicOffset = 0
+
+	// LVM2 physical volume label, which is in one of the first four sectors,
+	// see lvm(8)
+	fsTypeLVM          = "LVM2_member"
+	lvmLabelSectors    = 4
+	lvmLabelTypeOffset = 24
+	sectorSize         = 512
+
+	// GPT header in the second logical block, for 512 byte and 4096 byte
+	// sectors, see the UEFI specification
+	gptHeaderOffset    = sectorSize
+	gptHeaderOffset4Kn = 4096
+
+	// MBR partition table in the first sector
+	mbrSignatureOffset   = 510
+	mbrPartitionsOffset  = 446
+	mbrPartitionSize     = 16
+	mbrPartitionCount    = 4
+	mbrPartitionTypeByte = 4
+
+	// superblockProbeSize is the number of bytes read from the start of the
+	// device, it covers all signatures above
+	superblockProbeSize = btrfsMagicOffset + 8
+)
+
+var (
+	xfsMagic   = []byte("XFSB")
+	btrfsMagic = []byte("_BHRfS_M")
+	luksMagic  = []byte{'L', 'U', 'K', 'S', 0xba, 0xbe}
+	lvmLabel   = []byte("LABELONE")
+	lvmType    = []byte("LVM2 001")
+	gptMagic   = []byte("EFI PART")
+	mbrMagic   = []byte{0x55, 0xaa}
+)
+
+// deviceSignature describes the content found at the start of a device.
+type deviceSignature struct {
+	// Type is the filesystem or other content type, using the names of
+	// blkid, e.g. ext4, crypto_LUKS or LVM2_member
+	Type string
+	// PartitionTable is the partition table type, gpt or dos
+	PartitionTable string
+}
+
+// IsEmpty returns true when no signature was found.
+func (s deviceSignature) IsEmpty() bool {
+	return s.Type == "" && s.PartitionTable == ""
+}
+
+// IsFilesystem returns true when the device contains a filesystem the
+// driver can mount, and no partition table.
+func (s deviceSignature) IsFilesystem() bool {
+	switch s.Type {
+	case "ext2", "ext3", "ext4", "xfs", "btrfs":
+		return s.PartitionTable == ""
+	}
+	return false
+}
+
+// String describes the signature for log and error messages.
+func (s deviceSignature) String() string {
+	var parts []string
+	if s.PartitionTable != "" {
+		parts = append(parts, fmt.Sprintf("a %s partition table", s.PartitionTable))
+	}
+	if s.Type != "" {
+		parts = append(parts, fmt.Sprintf("a %s signature", s.Type))
+	}
+	if len(parts) == 0 {
+		return "no signature"
+	}
+	return strings.Join(parts, " and ")
+}
+
+// probeDevice reads the start of the device and returns the signatures it
+// found. Only the ext, xfs, btrfs, LUKS and LVM signatures and the GPT and
+// MBR partition tables are detected.
+func probeDevice(devicePath string) (deviceSignature, error) {
+	f, err := os.Open(devicePath)
+	if err != nil {
+		return deviceSignature{}, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, superblockProbeSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return deviceSignature{}, err
+	}
+	return deviceSignature{
+		Type:           probeSuperblock(buf[:n]),
+		PartitionTable: probePartitionTable(buf[:n]),
+	}, nil
+}
+
+// probePartitionTable returns the partition table type for the data read
+// from the start of a device, or an empty string when there is none.
+func probePartitionTable(buf []byte) string {
+	hasMagic := func(offset int, magic []byte) bool {
+		return len(buf) >= offset+len(magic) && bytes.Equal(buf[offset:offset+len(magic)], magic)
+	}
+
+	// the GPT header is in the second logical block, which depends on the
+	// sector size of the disk
+	if hasMagic(gptHeaderOffset, gptMagic) || hasMagic(gptHeaderOffset4Kn, gptMagic) {
+		return "gpt"
+	}
+
+	if !hasMagic(mbrSignatureOffset, mbrMagic) {
+		return ""
+	}
+	// boot sectors of filesystems also end with the MBR signature, so only
+	// treat it as a partition table when the entries are valid and at least
+	// one partition is used
+	used := false
+	for i := 0; i < mbrPartitionCount; i++ {
+		entry := buf[mbrPartitionsOffset+i*mbrPartitionSize:]
+		if entry[0] != 0x00 && entry[0] != 0x80 {
+			return ""
+		}
+		if entry[mbrPartitionTypeByte] != 0 {
+			used = true
+		}
+	}
+	if used {
+		return "dos"
+	}
+	return ""
+}
+
+// probeSuperblock returns the filesystem type for the signatures found in
+// the data read from the start of a device.
+func probeSuperblock(buf []byte) string {
+	hasMagic := func(offset int, magic []byte) bool {
+		return len(buf) >= offset+len(magic) && bytes.Equal(buf[offset:offset+len(magic)], magic)
+	}
+
+	for sector := 0; sector < lvmLabelSectors; sector++ {
+		offset := sector * sectorSize
+		if hasMagic(offset, lvmLabel) && hasMagic(offset+lvmLabelTypeOffset, lvmType) {
+			return fsTypeLVM
+		}
+	}
+
+	switch {
+	case hasMagic(luksMagicOffset, luksMagic):
+		return fsTypeLUKS
+	case hasMagic(xfsMagicOffset, xfsMagic):
+		return "xfs"
+	case hasMagic(btrfsMagicOffset, btrfsMagic):
+		return "btrfs"
+	}
+
+	if len(buf) >= extFeatureROCompatOffset+4 && binary.LittleEndian.Uint16(buf[extMagicOffset:]) == extMagic {
+		compat := binary.LittleEndian.Uint32(buf[extFeatureCompatOffset:])
+		incompat := binary.LittleEndian.Uint32(buf[extFeatureIncompatOffset:])
+		roCompat := binary.LittleEndian.Uint32(buf[extFeatureROCompatOffset:])
+
+		switch {
+		case incompat&extIncompatJournalDev != 0:
+			return "jbd"
+		case incompat&^extIncompatExt3Features != 0 || roCompat&^extROCompatExt2Features != 0:
+			// features that ext3 does not support, like extents
+			return "ext4"
+		case compat&extCompatHasJournal != 0:
+			return "ext3"
+		}
+		return "ext2"
+	}
+
+	return ""
+}
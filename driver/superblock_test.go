@@ -0,0 +1,171 @@
+package driver
+
+import (
+	"encoding/binary"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sparseImage creates a sparse image file of the given size with the given
+// data written at the offsets.
+func sparseImage(t *testing.T, size int64, data map[int64][]byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "disk.img")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, f.Truncate(size))
+	for offset, b := range data {
+		_, err := f.WriteAt(b, offset)
+		require.NoError(t, err)
+	}
+	return path
+}
+
+// extSuperblock returns the ext superblock fields used to detect the ext
+// version.
+func extSuperblock(compat, incompat, roCompat uint32) map[int64][]byte {
+	le16 := func(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+	le32 := func(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+	return map[int64][]byte{
+		extMagicOffset:           le16(extMagic),
+		extFeatureCompatOffset:   le32(compat),
+		extFeatureIncompatOffset: le32(incompat),
+		extFeatureROCompatOffset: le32(roCompat),
+	}
+}
+
+func TestProbeDevice(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+		data map[int64][]byte
+		want deviceSignature
+	}{
+		{
+			name: "empty device",
+			size: 16 * miB,
+		},
+		{
+			name: "device smaller than the btrfs superblock",
+			size: 4096,
+		},
+		{
+			name: "ext2",
+			size: 16 * miB,
+			data: extSuperblock(0, 0x0002, 0x0001),
+			want: deviceSignature{Type: "ext2"},
+		},
+		{
+			name: "ext3",
+			size: 16 * miB,
+			data: extSuperblock(extCompatHasJournal, 0x0002, 0x0001),
+			want: deviceSignature{Type: "ext3"},
+		},
+		{
+			name: "ext4 with extents",
+			size: 16 * miB,
+			data: extSuperblock(extCompatHasJournal, 0x0002|0x0040, 0x0001),
+			want: deviceSignature{Type: "ext4"},
+		},
+		{
+			name: "ext4 with metadata checksums",
+			size: 16 * miB,
+			data: extSuperblock(extCompatHasJournal, 0x0002, 0x0001|0x0400),
+			want: deviceSignature{Type: "ext4"},
+		},
+		{
+			name: "xfs",
+			size: 16 * miB,
+			data: map[int64][]byte{xfsMagicOffset: []byte("XFSB")},
+			want: deviceSignature{Type: "xfs"},
+		},
+		{
+			name: "btrfs",
+			size: 16 * miB,
+			data: map[int64][]byte{btrfsMagicOffset: []byte("_BHRfS_M")},
+			want: deviceSignature{Type: "btrfs"},
+		},
+		{
+			name: "LUKS",
+			size: 16 * miB,
+			data: map[int64][]byte{luksMagicOffset: {'L', 'U', 'K', 'S', 0xba, 0xbe, 0x00, 0x02}},
+			want: deviceSignature{Type: fsTypeLUKS},
+		},
+		{
+			name: "LVM physical volume",
+			size: 16 * miB,
+			data: map[int64][]byte{
+				sectorSize:                      []byte("LABELONE"),
+				sectorSize + lvmLabelTypeOffset: []byte("LVM2 001"),
+			},
+			want: deviceSignature{Type: fsTypeLVM},
+		},
+		{
+			name: "GPT partition table",
+			size: 16 * miB,
+			data: map[int64][]byte{
+				mbrPartitionsOffset + mbrPartitionTypeByte: {0xee},
+				mbrSignatureOffset:                         {0x55, 0xaa},
+				gptHeaderOffset:                            []byte("EFI PART"),
+			},
+			want: deviceSignature{PartitionTable: "gpt"},
+		},
+		{
+			name: "GPT partition table with 4096 byte sectors",
+			size: 16 * miB,
+			data: map[int64][]byte{gptHeaderOffset4Kn: []byte("EFI PART")},
+			want: deviceSignature{PartitionTable: "gpt"},
+		},
+		{
+			name: "MBR partition table",
+			size: 16 * miB,
+			data: map[int64][]byte{
+				mbrPartitionsOffset:                        {0x80},
+				mbrPartitionsOffset + mbrPartitionTypeByte: {0x83},
+				mbrSignatureOffset:                         {0x55, 0xaa},
+			},
+			want: deviceSignature{PartitionTable: "dos"},
+		},
+		{
+			name: "boot sector without partitions",
+			size: 16 * miB,
+			data: map[int64][]byte{
+				mbrPartitionsOffset: {0xeb, 0x3c, 0x90},
+				mbrSignatureOffset:  {0x55, 0xaa},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := probeDevice(sparseImage(t, tt.size, tt.data))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMounterIsFormatted(t *testing.T) {
+	m := &mounter{
+		log: slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	}
+
+	formatted, err := m.IsFormatted(sparseImage(t, 16*miB, map[int64][]byte{xfsMagicOffset: []byte("XFSB")}))
+	require.NoError(t, err)
+	require.True(t, formatted)
+}
+
+func TestParseBlkidExport(t *testing.T) {
+	out := "DEVNAME=/dev/sdb\nPTUUID=6f1ac1b2\nPTTYPE=dos\n"
+	require.Equal(t, deviceSignature{PartitionTable: "dos"}, parseBlkidExport(out))
+
+	out = "DEVNAME=/dev/sdc\nVERSION=1.0\nTYPE=swap\nUSAGE=other\n"
+	require.Equal(t, deviceSignature{Type: "swap"}, parseBlkidExport(out))
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// defaultSysPath is where sysfs is mounted
+const defaultSysPath = "/sys"
+
+// volumeHealth is the outcome of the health checks of a mounted volume.
+type volumeHealth struct {
+	// Problems describes why the volume is abnormal, it is empty when the
+	// volume is healthy
+	Problems []string
+}
+
+// IsAbnormal returns whether any of the health checks failed.
+func (h volumeHealth) IsAbnormal() bool {
+	return len(h.Problems) > 0
+}
+
+// GetVolumeHealth checks whether the filesystem mounted at the volume path was
+// remounted read only, whether its device has disappeared or is no longer
+// running, and whether an ext filesystem reported errors. devicePath is the
+// device of a block volume, the device of a filesystem volume is found with
+// the mount table.
+func (m *mounter) GetVolumeHealth(volumePath, devicePath string) (volumeHealth, error) {
+	var health volumeHealth
+
+	path := m.mountInfoPath
+	if path == "" {
+		path = mountInfoPath
+	}
+	mounts, err := readMountInfo(path)
+	if err != nil {
+		return health, err
+	}
+
+	// the last entry is the mount on top
+	target := filepath.Clean(volumePath)
+	var mi *mountInfo
+	for i := range mounts {
+		if mounts[i].MountPoint == target {
+			mi = &mounts[i]
+		}
+	}
+	if mi == nil {
+		return health, fmt.Errorf("volume path %q is not mounted", volumePath)
+	}
+
+	// filesystems are remounted read only below a read-write mount when they
+	// run into errors, e.g. with errors=remount-ro
+	if hasMountOption(mi.SuperOptions, "ro") && !hasMountOption(mi.MountOptions, "ro") {
+		health.Problems = append(health.Problems, "filesystem was remounted read only, which happens after filesystem errors")
+	}
+
+	device, found, err := m.volumeDevice(mi, devicePath)
+	if err != nil {
+		return health, err
+	}
+	if !found {
+		health.Problems = append(health.Problems, fmt.Sprintf("device %s of the volume has disappeared", device))
+		return health, nil
+	}
+	if device == "" {
+		return health, nil
+	}
+
+	state, err := m.deviceState(device)
+	if err != nil {
+		return health, err
+	}
+	// SCSI devices report running, NVMe controllers live
+	if state != "" && state != runningState && state != "live" {
+		health.Problems = append(health.Problems, fmt.Sprintf("device %s is in state %q", device, state))
+	}
+
+	if strings.HasPrefix(mi.FsType, "ext") {
+		content, err := os.ReadFile(filepath.Join(m.sysPath, "fs", "ext4", device, "errors_count"))
+		if err != nil && !os.IsNotExist(err) {
+			return health, err
+		}
+		if err == nil {
+			errorsCount, err := strconv.Atoi(strings.TrimSpace(string(content)))
+			if err != nil {
+				return health, fmt.Errorf("invalid errors_count of device %s: %v", device, err)
+			}
+			if errorsCount > 0 {
+				health.Problems = append(health.Problems, fmt.Sprintf("filesystem reported %d errors", errorsCount))
+			}
+		}
+	}
+
+	return health, nil
+}
+
+// volumeDevice returns the kernel name of the device of the mount, e.g. sdb
+// or sdb1, and whether it still exists. The device of a filesystem is found
+// via its major:minor in /sys/dev/block, or its source for filesystems with
+// an anonymous device such as btrfs. An empty name is returned when the
+// mount has no block device.
+func (m *mounter) volumeDevice(mi *mountInfo, devicePath string) (string, bool, error) {
+	var link string
+	switch {
+	case devicePath != "":
+		link = devicePath
+	case mi.MajorMinor != "" && !strings.HasPrefix(mi.MajorMinor, "0:"):
+		link = filepath.Join(m.sysPath, "dev", "block", mi.MajorMinor)
+	case strings.HasPrefix(mi.Source, "/dev/"):
+		link = mi.Source
+	default:
+		return "", true, nil
+	}
+
+	resolved, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			if devicePath == "" && mi.Source != "" {
+				return mi.Source, false, nil
+			}
+			return link, false, nil
+		}
+		return "", false, err
+	}
+
+	device := filepath.Base(resolved)
+	if _, err := os.Stat(filepath.Join(m.sysPath, "class", "block", device)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return device, false, nil
+		}
+		return "", false, err
+	}
+	return device, true, nil
+}
+
+// deviceState returns the state of the disk of the device as reported in
+// /sys/class/block/<disk>/device/state, or an empty string if the disk does
+// not report a state.
+func (m *mounter) deviceState(device string) (string, error) {
+	dir := filepath.Join(m.sysPath, "class", "block", device)
+	// partitions are a directory of their disk
+	if _, err := os.Stat(filepath.Join(dir, "partition")); err == nil {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(m.sysPath, "class", "block", filepath.Base(filepath.Dir(resolved)))
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "device", "state"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// hasMountOption returns whether the comma separated mount options contain
+// the option.
+func hasMountOption(options, option string) bool {
+	return slices.Contains(strings.Split(options, ","), option)
+}
+
+// nodeVolumeCondition returns the condition of a mounted volume. It is
+// abnormal when the health checks of the volume fail, otherwise it is the
+// outcome of the filesystem check when the volume was staged.
+func (d *Driver) nodeVolumeCondition(volumeID, volumePath, devicePath string, log *slog.Logger) *csi.VolumeCondition {
+	staged := d.stagedVolumeCondition(volumeID)
+
+	health, err := d.mounter.GetVolumeHealth(volumePath, devicePath)
+	if err != nil {
+		// failing to check the health should not fail the statistics
+		log.Warn("failed to check the health of the volume", "error", err)
+		return staged
+	}
+
+	if health.IsAbnormal() {
+		problems := health.Problems
+		if staged.GetAbnormal() {
+			problems = append(problems, staged.GetMessage())
+		}
+		log.Warn("volume is abnormal", "problems", problems)
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  strings.Join(problems, "; "),
+		}
+	}
+
+	if staged != nil {
+		return staged
+	}
+	return &csi.VolumeCondition{
+		Message: "volume is healthy",
+	}
+}
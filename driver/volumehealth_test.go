@@ -0,0 +1,264 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+)
+
+// testSysfs creates a sysfs tree with the disk sdb (8:16) and its partition
+// sdb1 (8:17).
+func testSysfs(t *testing.T, state string) string {
+	t.Helper()
+
+	sys := t.TempDir()
+	disk := filepath.Join(sys, "devices", "virtual", "block", "sdb")
+	require.NoError(t, os.MkdirAll(filepath.Join(disk, "device"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(disk, "sdb1"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(disk, "device", "state"), []byte(state+"\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(disk, "sdb1", "partition"), []byte("1\n"), 0644))
+
+	for _, dir := range []string{"class/block", "dev/block", "fs/ext4/sdb"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(sys, dir), 0755))
+	}
+	require.NoError(t, os.Symlink(disk, filepath.Join(sys, "class", "block", "sdb")))
+	require.NoError(t, os.Symlink(filepath.Join(disk, "sdb1"), filepath.Join(sys, "class", "block", "sdb1")))
+	require.NoError(t, os.Symlink(disk, filepath.Join(sys, "dev", "block", "8:16")))
+	require.NoError(t, os.Symlink(filepath.Join(disk, "sdb1"), filepath.Join(sys, "dev", "block", "8:17")))
+	return sys
+}
+
+func TestGetVolumeHealth(t *testing.T) {
+	const target = "/var/lib/kubelet/plugins/kubernetes.io/csi/staging/mount"
+
+	tests := []struct {
+		name         string
+		mountInfo    string
+		state        string
+		errorsCount  string
+		devicePath   func(sys string) string
+		wantProblems []string
+	}{
+		{
+			name:      "healthy filesystem",
+			mountInfo: "130 22 8:16 / " + target + " rw,relatime shared:70 - ext4 /dev/sdb rw\n",
+			state:     "running",
+		},
+		{
+			name:      "read only mount",
+			mountInfo: "130 22 8:16 / " + target + " ro,relatime shared:70 - ext4 /dev/sdb ro,noload\n",
+			state:     "running",
+		},
+		{
+			name:         "remounted read only after errors",
+			mountInfo:    "130 22 8:16 / " + target + " rw,relatime shared:70 - ext4 /dev/sdb ro,errors=remount-ro\n",
+			state:        "running",
+			wantProblems: []string{"filesystem was remounted read only, which happens after filesystem errors"},
+		},
+		{
+			name:         "device disappeared",
+			mountInfo:    "130 22 8:32 / " + target + " rw,relatime shared:70 - ext4 /dev/sdc rw\n",
+			state:        "running",
+			wantProblems: []string{"device /dev/sdc of the volume has disappeared"},
+		},
+		{
+			name:         "device offline",
+			mountInfo:    "130 22 8:16 / " + target + " rw,relatime shared:70 - xfs /dev/sdb rw\n",
+			state:        "offline",
+			wantProblems: []string{`device sdb is in state "offline"`},
+		},
+		{
+			name:         "state of the disk of a partition",
+			mountInfo:    "130 22 8:17 / " + target + " rw,relatime shared:70 - xfs /dev/sdb1 rw\n",
+			state:        "blocked",
+			wantProblems: []string{`device sdb1 is in state "blocked"`},
+		},
+		{
+			name:         "ext4 errors",
+			mountInfo:    "130 22 8:16 / " + target + " rw,relatime shared:70 - ext4 /dev/sdb rw\n",
+			state:        "running",
+			errorsCount:  "3",
+			wantProblems: []string{"filesystem reported 3 errors"},
+		},
+		{
+			name:      "block volume",
+			mountInfo: "130 22 0:5 /sdb " + target + " rw,relatime shared:70 - devtmpfs udev rw\n",
+			state:     "running",
+			devicePath: func(sys string) string {
+				return filepath.Join(sys, "class", "block", "sdb")
+			},
+		},
+		{
+			name:      "block volume device disappeared",
+			mountInfo: "130 22 0:5 /sdc " + target + " rw,relatime shared:70 - devtmpfs udev rw\n",
+			state:     "running",
+			devicePath: func(sys string) string {
+				return "/dev/csi-thalassa-test-missing"
+			},
+			wantProblems: []string{"device /dev/csi-thalassa-test-missing of the volume has disappeared"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys := testSysfs(t, tt.state)
+			if tt.errorsCount != "" {
+				require.NoError(t, os.WriteFile(filepath.Join(sys, "fs", "ext4", "sdb", "errors_count"), []byte(tt.errorsCount+"\n"), 0644))
+			}
+			mountInfoFile := filepath.Join(t.TempDir(), "mountinfo")
+			require.NoError(t, os.WriteFile(mountInfoFile, []byte(tt.mountInfo), 0644))
+
+			m := &mounter{
+				log:           slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				mountInfoPath: mountInfoFile,
+				sysPath:       sys,
+			}
+
+			devicePath := ""
+			if tt.devicePath != nil {
+				devicePath = tt.devicePath(sys)
+			}
+
+			health, err := m.GetVolumeHealth(target, devicePath)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantProblems, health.Problems)
+		})
+	}
+
+	t.Run("not mounted", func(t *testing.T) {
+		m := &mounter{
+			log:           slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			mountInfoPath: "testdata/mountinfo",
+			sysPath:       t.TempDir(),
+		}
+		_, err := m.GetVolumeHealth(target, "")
+		require.EqualError(t, err, `volume path "`+target+`" is not mounted`)
+	})
+}
+
+func TestNodeVolumeCondition(t *testing.T) {
+	tests := []struct {
+		name   string
+		health volumeHealth
+		staged *csi.VolumeCondition
+		want   *csi.VolumeCondition
+	}{
+		{
+			name: "healthy",
+			want: &csi.VolumeCondition{Message: "volume is healthy"},
+		},
+		{
+			name:   "outcome of the filesystem check",
+			staged: &csi.VolumeCondition{Message: "filesystem check found no errors"},
+			want:   &csi.VolumeCondition{Message: "filesystem check found no errors"},
+		},
+		{
+			name:   "abnormal",
+			health: volumeHealth{Problems: []string{"device sdb is in state \"offline\"", "filesystem reported 3 errors"}},
+			staged: &csi.VolumeCondition{Message: "filesystem check found no errors"},
+			want: &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  "device sdb is in state \"offline\"; filesystem reported 3 errors",
+			},
+		},
+		{
+			name:   "abnormal and filesystem check found errors",
+			health: volumeHealth{Problems: []string{"filesystem reported 3 errors"}},
+			staged: &csi.VolumeCondition{Abnormal: true, Message: "filesystem check found errors that were not repaired"},
+			want: &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  "filesystem reported 3 errors; filesystem check found errors that were not repaired",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMounter := NewMockMounter()
+			mockMounter.Health["/tmp/target"] = tt.health
+
+			driver := &Driver{
+				mounter: mockMounter,
+				log:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			}
+			if tt.staged != nil {
+				driver.setVolumeCondition("test-volume", tt.staged)
+			}
+
+			got := driver.nodeVolumeCondition("test-volume", "/tmp/target", "", driver.log)
+			require.Equal(t, tt.want.Abnormal, got.Abnormal)
+			require.Equal(t, tt.want.Message, got.Message)
+		})
+	}
+}
+
+func TestNodeGetVolumeStatsBlockVolume(t *testing.T) {
+	const (
+		targetPath = "/var/lib/kubelet/plugins/kubernetes.io/csi/volumeDevices/publish/pv-1/pod-1"
+		devicePath = "/dev/sdb"
+	)
+
+	tests := []struct {
+		name        string
+		deviceErr   error
+		wantTotal   int64
+		wantMessage string
+		wantErr     bool
+	}{
+		{
+			name:        "device is present",
+			wantTotal:   10 * giB,
+			wantMessage: "volume is healthy",
+		},
+		{
+			name:        "device is gone",
+			deviceErr:   fmt.Errorf("%w: no block device with major:minor 8:16", ErrDeviceNotFound),
+			wantMessage: "device of block volume is gone: device not found: no block device with major:minor 8:16",
+		},
+		{
+			name:      "device lookup fails",
+			deviceErr: fmt.Errorf("permission denied"),
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMounter := NewMockMounter()
+			mockMounter.MountPoints[targetPath] = devicePath
+			mockMounter.BlockDevices[targetPath] = true
+			mockMounter.BlockDeviceErrors[targetPath] = tt.deviceErr
+			mockMounter.Statistics[devicePath] = volumeStatistics{totalBytes: 10 * giB}
+
+			driver := &Driver{
+				mounter: mockMounter,
+				log:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			}
+
+			resp, err := driver.NodeGetVolumeStats(context.Background(), &csi.NodeGetVolumeStatsRequest{
+				VolumeId:   "test-volume",
+				VolumePath: targetPath,
+			})
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantMessage, resp.VolumeCondition.GetMessage())
+			if tt.wantTotal == 0 {
+				require.True(t, resp.VolumeCondition.GetAbnormal())
+				require.Empty(t, resp.Usage)
+				return
+			}
+			require.False(t, resp.VolumeCondition.GetAbnormal())
+			require.Len(t, resp.Usage, 1)
+			require.Equal(t, tt.wantTotal, resp.Usage[0].Total)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2025 Thalassa Cloud
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+
+	"github.com/thalassa-cloud/client-go/iaas"
+)
+
+// volumeUpdateFunc returns the update of the volume, based on its current
+// state, or nil when the volume does not need to be updated.
+type volumeUpdateFunc func(vol *iaas.Volume) (*iaas.UpdateVolume, error)
+
+// newVolumeUpdate returns an update that keeps the fields of the volume.
+func newVolumeUpdate(vol *iaas.Volume) *iaas.UpdateVolume {
+	return &iaas.UpdateVolume{
+		Name:             vol.Name,
+		Description:      vol.Description,
+		Labels:           vol.Labels,
+		Annotations:      vol.Annotations,
+		Size:             vol.Size,
+		DeleteProtection: vol.DeleteProtection,
+	}
+}
+
+// updateVolume reads the volume and writes the update built from it, and
+// must be used for every write of a volume. The API replaces all fields of a
+// volume on update and has no conditional update, so this is last writer
+// wins: reading the volume right before the update keeps the window in which
+// a concurrent change is overwritten short, but does not close it.
+func (d *Driver) updateVolume(ctx context.Context, volumeID string, update volumeUpdateFunc) (*iaas.Volume, error) {
+	vol, err := d.iaas.GetVolume(ctx, volumeID)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := update(vol)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return vol, nil
+	}
+	return d.iaas.UpdateVolume(ctx, volumeID, *req)
+}
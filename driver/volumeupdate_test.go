@@ -0,0 +1,82 @@
+package driver
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/thalassa-cloud/client-go/iaas"
+)
+
+func TestUpdateVolume(t *testing.T) {
+	resize := func(vol *iaas.Volume) (*iaas.UpdateVolume, error) {
+		if vol.Size >= 20 {
+			return nil, nil
+		}
+		update := newVolumeUpdate(vol)
+		update.Size = 20
+		return update, nil
+	}
+
+	tests := []struct {
+		name        string
+		change      func(vol *iaas.Volume)
+		wantUpdates int
+		wantSize    int
+		wantLabels  iaas.Labels
+	}{
+		{
+			name:        "resize",
+			change:      func(vol *iaas.Volume) {},
+			wantUpdates: 1,
+			wantSize:    20,
+			wantLabels:  iaas.Labels{"team": "a"},
+		},
+		{
+			name: "update is built from the latest state",
+			change: func(vol *iaas.Volume) {
+				vol.Labels = iaas.Labels{"team": "b"}
+			},
+			wantUpdates: 1,
+			wantSize:    20,
+			wantLabels:  iaas.Labels{"team": "b"},
+		},
+		{
+			name: "volume was already resized",
+			change: func(vol *iaas.Volume) {
+				vol.Size = 30
+			},
+			wantSize:   30,
+			wantLabels: iaas.Labels{"team": "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volume := &iaas.Volume{
+				Identity: "vol-1",
+				Name:     "vol-1",
+				Size:     10,
+				Labels:   iaas.Labels{"team": "a"},
+			}
+			api, iaasClient := newFakeAPI(t, map[string]*iaas.Volume{volume.Identity: volume})
+			api.onGetVolume = tt.change
+
+			driver := &Driver{
+				iaas: iaasClient,
+				log:  slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			}
+
+			vol, err := driver.updateVolume(context.Background(), "vol-1", resize)
+			require.NoError(t, err)
+			require.Len(t, api.Updates(), tt.wantUpdates)
+			require.Equal(t, tt.wantSize, vol.Size)
+			require.Equal(t, tt.wantLabels, vol.Labels)
+			for _, update := range api.Updates() {
+				require.Equal(t, tt.wantLabels, update.Labels)
+			}
+		})
+	}
+}